@@ -2,9 +2,12 @@ Alpine.store('media', {
     listMode: 'list',
     _folders: [],
     current: '/',
+    siteId: '', // empty is the shared library
+    sites: [],
     current_dirs: [],
     fileChoice: '',
     uploading: false,
+    existsPath: '', // the uploaded file is the same as the media at existsPath
     _previewUrl: '',
     _localPreview: false,
     _canPreview: false,
@@ -22,6 +25,23 @@ Alpine.store('media', {
         return this._folders.length
     },
 
+    async loadSites() {
+        const obj = Alpine.store('objects').find(obj => obj.name === 'Site')
+        if (!obj) {
+            return
+        }
+        let resp = await fetch(`${obj.path}`, {
+            method: 'POST', body: '{}'
+        })
+        let data = await resp.json()
+        this.sites = data.items || []
+    },
+
+    async changeSite(siteId) {
+        this.siteId = siteId || ''
+        await this.refreshFolders()
+    },
+
     async refreshFolders() {
         this.uploading = false
         this.current = '/'
@@ -44,7 +64,7 @@ Alpine.store('media', {
         if (this._folders.find(f => f.name === name)) {
             return
         }
-        let url = `./media/new_folder?path=${this.current}&name=${name}`
+        let url = `./media/new_folder?site_id=${this.siteId}&path=${this.current}&name=${name}`
         let req = await fetch(url, {
             method: 'POST',
         })
@@ -70,7 +90,7 @@ Alpine.store('media', {
         })
 
         this.current_dirs = dirs
-        let url = `./media/folders?path=${this.current}`
+        let url = `./media/folders?site_id=${this.siteId}&path=${this.current}`
 
         let req = await fetch(url, {
             method: 'POST',
@@ -90,6 +110,7 @@ Alpine.store('media', {
         }
         let query = Alpine.store('queryresult')
         query.setFilters([
+            { name: 'site_id', value: this.siteId, op: '=' },
             { name: 'path', value: path, op: '=' },
             { name: 'directory', value: false, op: '=' },
         ]).refresh()
@@ -98,6 +119,7 @@ Alpine.store('media', {
     choiceFile(data, file) {
         data.choicename = `${file.name} (${formatSizeHuman(file.size)})`
         data.choice = file
+        this.existsPath = ''
 
         if (file) {
             if (file.type.match('image.*')) {
@@ -129,7 +151,7 @@ Alpine.store('media', {
 
         let path = this.current
         let name = editobj.names.name.value || data.choice.name
-        let url = `./media/upload?path=${path}&name=${name}`
+        let url = `./media/upload?site_id=${this.siteId}&path=${path}&name=${name}`
 
         data.choice = undefined
         data.choicename = undefined
@@ -155,10 +177,17 @@ Alpine.store('media', {
                 return false
             }
 
-            let { storePath, dimensions, ext, size, contentType, publicUrl, external } = data
+            let { storePath, dimensions, ext, size, contentType, publicUrl, external, storage, hash, exists, existsPath } = data
             editobj.names.store_path.value = storePath
             editobj.names.store_path.dirty = true
 
+            editobj.names.storage.value = storage
+            editobj.names.storage.dirty = true
+
+            editobj.names.hash.value = hash
+            editobj.names.hash.dirty = true
+            this.existsPath = exists ? existsPath : ''
+
             editobj.names.external.value = external
             editobj.names.external.dirty = true
 
@@ -222,7 +251,7 @@ Alpine.store('media', {
                     this.changeFolder(result).then()
                 }
             }, keys: [
-                { path: dir },
+                { site_id: this.siteId, path: dir },
             ]
         })
     },
@@ -287,7 +316,9 @@ Alpine.store('media', {
         currentObj.prepareEdit = (editobj, isCreate, row) => {
             Alpine.store('media')._previewUrl = ''
             Alpine.store('media')._localPreview = false
+            Alpine.store('media').existsPath = ''
             if (isCreate) {
+                editobj.names.site_id.value = this.siteId
                 editobj.names.path.value = this.current
                 editobj.names.published.value = true
             }
@@ -300,6 +331,7 @@ Alpine.store('media', {
         }
 
         currentObj.prepareQuery = (query, source) => {
+            query.filters.push({ name: 'site_id', value: this.siteId, op: '=' })
             query.filters.push({ name: 'path', value: this.current, op: '=' })
             query.filters.push({ name: 'directory', value: false, op: '=' })
             return query
@@ -315,6 +347,7 @@ Alpine.store('media', {
         }
         injectFrom('result_head_form', 'media_path.html')
         injectFrom('result_form_grid', 'list_media_grid.html')
+        this.loadSites().then()
         this.refreshFolders().then()
     },
 })
@@ -379,18 +379,27 @@ class TagsWidget extends window.AdminWidgets.string {
             }
         })
 
-        this.tags.forEach((v) => {
-            this.options.appendChild(this.createTagSelectItem(v))
-        })
+        const choices = this.field.attribute && this.field.attribute.choices
+        if (choices) {
+            // only the choices can be selected, eg: the scopes of api token
+            menu.querySelector('input').parentElement.classList.add('hidden')
+            choices.forEach((choice) => {
+                this.options.appendChild(this.createTagSelectItem(choice.value))
+            })
+        } else {
+            this.tags.forEach((v) => {
+                this.options.appendChild(this.createTagSelectItem(v))
+            })
 
-        TagsWidget.loadExistsTags(Alpine.store('current').path).then((items) => {
-            items.forEach((text) => {
-                if (this.tags.findIndex((v) => v.toLowerCase() === text.toLowerCase()) != -1) {
-                    return
-                }
-                this.options.appendChild(this.createTagSelectItem(text))
+            TagsWidget.loadExistsTags(Alpine.store('current').path).then((items) => {
+                items.forEach((text) => {
+                    if (this.tags.findIndex((v) => v.toLowerCase() === text.toLowerCase()) != -1) {
+                        return
+                    }
+                    this.options.appendChild(this.createTagSelectItem(text))
+                })
             })
-        })
+        }
 
         appendDiv.appendChild(menu)
         node.appendChild(appendDiv)
@@ -34,23 +34,38 @@ func (m *Manager) adminObjects() []carrot.AdminObject {
 					Op:   carrot.OrderOpDesc,
 				},
 			},
-			Editables:   []string{"Domain", "Name", "Preview", "Disallow"},
+			Editables:   []string{"Domain", "Name", "Preview", "Disallow", "Group", "PageUrlPattern", "PostUrlPattern"},
 			Filterables: []string{"Disallow"},
 			Orderables:  []string{},
 			Searchables: []string{"Domain", "Name", "Preview"},
 			Requireds:   []string{"Domain"},
 			Icon:        readIcon("./icon/desktop.svg"),
+			Attributes: map[string]carrot.AdminAttribute{
+				"PageUrlPattern": {Help: "Frontend url of page for sitemap and feeds, default is https://{domain}/{id}"},
+				"PostUrlPattern": {Help: "Frontend url of post for sitemap and feeds, default is https://{domain}/post/{id}"},
+				"Group":          {SingleChoice: true, Help: "Members of the group with role viewer, author, editor, publisher or admin, eg: editor or editor:post for posts only. Empty is open to all staff"},
+			},
 			Scripts: []carrot.AdminScript{
 				{Src: "./js/cms_site.js", Onload: true},
 			},
+			Actions: []carrot.AdminAction{
+				{
+					Path:    "regenerate_api_key",
+					Name:    "Regenerate API Key",
+					Handler: m.handleRegenerateSiteApiKey,
+				},
+			},
+			BeforeCreate: m.beforeCreateSite,
+			BeforeUpdate: m.beforeUpdateSite,
+			BeforeDelete: m.beforeDeleteSite,
 		},
 		{
 			Model:       &models.Category{},
 			Group:       "Contents",
 			Name:        "Category",
 			Desc:        "The category of articles and pages can be multi-level",
-			Shows:       []string{"Name", "UUID", "Site", "Items"},
-			Editables:   []string{"Name", "UUID", "Site", "Items"},
+			Shows:       []string{"Name", "UUID", "Site", "ReviewRequired", "Items"},
+			Editables:   []string{"Name", "UUID", "Site", "ReviewRequired", "Items"},
 			Orderables:  []string{},
 			Searchables: []string{"UUID", "Site", "Items", "Name"},
 			Requireds:   []string{"UUID", "Site", "Items", "Name"},
@@ -68,26 +83,32 @@ func (m *Manager) adminObjects() []carrot.AdminObject {
 					Handler:       m.handleQueryCategoryWithCount,
 				},
 			},
+			BeforeCreate: m.beforeCreateCategory,
+			BeforeUpdate: m.beforeUpdateCategory,
+			BeforeDelete: m.beforeDeleteCategory,
 		},
 		m.getPageObject(),
 		m.getPostObject(),
 		m.getMediaObject(),
+		m.getTagObject(),
+		m.getApiTokenObject(),
 		{
 			Model:     &models.PublishLog{},
 			Invisible: true,
 			Group:     "Contents",
 			Name:      "PublishLog",
 			Desc:      "Post and Page publish log",
-			Shows:     []string{"ID", "Author", "ContentID", "CreatedAt"},
+			Shows:     []string{"ID", "Author", "Content", "SiteID", "ContentID", "Title", "CreatedAt"},
 			Orders: []carrot.Order{
 				{
 					Name: "CreatedAt",
 					Op:   carrot.OrderOpDesc,
 				},
 			},
-			Editables: []string{"ID", "Author", "ContentID", "Body"},
+			Editables: []string{"ID", "Author", "Content", "SiteID", "ContentID", "Title", "Alt", "Description", "Keywords", "ContentAuthor", "ContentType", "Body"},
 		},
 	}
+	vals = append(vals, m.getWebhookObjects()...)
 	settings := carrot.GetCarrotAdminObjects()
 	vals = append(vals, settings...)
 	carrot.Warning("Admin objects count:", len(vals))
@@ -101,8 +122,17 @@ func (m *Manager) handleQueryCategoryWithCount(db *gorm.DB, c *gin.Context, obj
 }
 
 func (m *Manager) handleAdminSummary(c *gin.Context) {
-	result := models.GetSummary(m.db)
+	result := models.GetSummary(m.db, carrot.CurrentUser(c))
 	result.BuildTime = m.BuildTime
 	result.CanExport = carrot.CurrentUser(c).IsSuperUser
 	c.JSON(http.StatusOK, result)
 }
+
+// Create or rotate the read only api key of site, the key is never listed, only returned here
+func (m *Manager) handleRegenerateSiteApiKey(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+	domain := c.Query("domain")
+	if err := checkPermission(db, c, domain, models.ContentNameSite, models.PermManage); err != nil {
+		return nil, err
+	}
+	return models.RegenerateSiteApiKey(db, domain)
+}
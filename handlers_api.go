@@ -0,0 +1,115 @@
+package restcontent
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/restsend/carrot"
+	"github.com/restsend/restcontent/models"
+	"gorm.io/gorm"
+)
+
+type apiActionFunc func(db *gorm.DB, c *gin.Context, obj any) (any, error)
+
+func newContentObject(content string) any {
+	switch content {
+	case models.ContentNamePost:
+		return &models.Post{}
+	case models.ContentNamePage:
+		return &models.Page{}
+	case models.ContentNameMedia:
+		return &models.Media{}
+	}
+	return nil
+}
+
+// Register the admin actions of content to public api, eg: POST /api/post/make_publish?site_id=xx&id=xx
+func (m *Manager) registerApiActions(r gin.IRoutes, content string, actions map[string]apiActionFunc) {
+	for path, handler := range actions {
+		r.POST("/"+content+"/"+path, m.handleApiAction(content, handler))
+	}
+}
+
+func (m *Manager) handleApiAction(content string, handler apiActionFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		obj := newContentObject(content)
+		if content == models.ContentNamePost || content == models.ContentNamePage {
+			siteId := c.Query("site_id")
+			if err := checkSiteScope(c, siteId); err != nil {
+				carrot.AbortWithJSONError(c, http.StatusForbidden, err)
+				return
+			}
+			if err := m.db.Where("site_id", siteId).Where("id", c.Query("id")).First(obj).Error; err != nil {
+				carrot.AbortWithJSONError(c, http.StatusNotFound, err)
+				return
+			}
+		}
+		r, err := handler(m.db, c, obj)
+		if err != nil {
+			code := http.StatusBadRequest
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				code = http.StatusNotFound
+			}
+			carrot.AbortWithJSONError(c, code, err)
+			return
+		}
+		c.JSON(http.StatusOK, r)
+	}
+}
+
+func (m *Manager) handleApiUpload(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+	return m.uploadMedia(db, c, true)
+}
+
+func (m *Manager) beforeCreateCategory(db *gorm.DB, ctx *gin.Context, vptr any) error {
+	category := vptr.(*models.Category)
+	if err := checkSiteScope(ctx, category.SiteID); err != nil {
+		return err
+	}
+	if err := checkPermission(db, ctx, category.SiteID, models.ContentNameCategory, models.PermCreate); err != nil {
+		return err
+	}
+	if category.UUID == "" {
+		category.UUID = carrot.RandText(models.DefaultCategoryUUIDSize)
+	}
+	return nil
+}
+
+func (m *Manager) beforeUpdateCategory(db *gorm.DB, ctx *gin.Context, vptr any, vals map[string]any) error {
+	category := vptr.(*models.Category)
+	if err := checkPermission(db, ctx, category.SiteID, models.ContentNameCategory, models.PermUpdate); err != nil {
+		return err
+	}
+	if _, ok := vals["review_required"]; ok {
+		// only the site admin can change the review policy
+		if err := checkPermission(db, ctx, category.SiteID, models.ContentNameCategory, models.PermManage); err != nil {
+			return err
+		}
+	}
+	if siteId, ok := vals["site_id"].(string); ok {
+		if err := checkSiteScope(ctx, siteId); err != nil {
+			return err
+		}
+		return checkPermission(db, ctx, siteId, models.ContentNameCategory, models.PermCreate)
+	}
+	return nil
+}
+
+func (m *Manager) beforeDeleteCategory(db *gorm.DB, ctx *gin.Context, vptr any) error {
+	category := vptr.(*models.Category)
+	return checkPermission(db, ctx, category.SiteID, models.ContentNameCategory, models.PermDelete)
+}
+
+// Guest can only read the published media
+// The media of site and the shared library
+func (m *Manager) getMediaDB(ctx *gin.Context, isCreate bool) *gorm.DB {
+	db := m.db
+	if scope := getSiteScope(ctx); scope != "" {
+		db = db.Where("site_id IN ?", []string{scope, ""})
+	}
+	if isGuest(ctx) {
+		return db.Where("site_id NOT IN (?)", models.DisallowSites(m.db)).Where("published", true)
+	}
+	return db
+}
@@ -136,6 +136,10 @@ func (job *ImportJob) Start(options []string) {
 				return
 			}
 		}
+		// build the tag table from the imported tags string
+		if err := models.MigrateLegacyTags(tx); err != nil {
+			carrot.Warning("Import tags failed:", err)
+		}
 		tx.Commit()
 		tx = nil
 		job.mutex.Lock()
@@ -227,19 +231,20 @@ func (job *ImportJob) Import(tx *gorm.DB, zipReader *zip.Reader, opt string) err
 			}
 			defer f.Close()
 
-			data := bytes.NewBuffer(nil)
-			io.Copy(data, f)
-			r, err := models.UploadFile(tx, media.Path, media.Name, data)
+			r, err := models.UploadFile(tx, media.Path, media.Name, f)
 			if err != nil {
 				return false, err
 			}
 
 			media.StorePath = r.StorePath
+			media.Hash = r.Hash
 			media.Size = r.Size
 			media.ContentType = r.ContentType
 			media.Ext = r.Ext
 			media.External = r.External
+			media.Storage = r.Storage
 			media.Dimensions = r.Dimensions
+			media.Variants = r.Variants
 
 			media.Directory = false
 			media.Published = true
@@ -257,7 +262,7 @@ func (job *ImportJob) Import(tx *gorm.DB, zipReader *zip.Reader, opt string) err
 		newMediaPrefix := carrot.GetValue(job.m.db, models.KEY_CMS_MEDIA_PREFIX)
 		newMediaHost += newMediaPrefix
 
-		return job.importTable(tx, zipReader, opt, func(zr *zip.Reader, modelObj any) (bool, error) {
+		err := job.importTable(tx, zipReader, opt, func(zr *zip.Reader, modelObj any) (bool, error) {
 			if origMediaHost == newMediaHost {
 				return true, nil
 			}
@@ -276,6 +281,12 @@ func (job *ImportJob) Import(tx *gorm.DB, zipReader *zip.Reader, opt string) err
 			}
 			return true, nil
 		})
+		if err != nil {
+			return err
+		}
+		// the references of imported contents
+		_, err = models.RebuildMediaReferences(tx)
+		return err
 	}
 	return job.importTable(tx, zipReader, opt, nil)
 }
@@ -366,12 +377,11 @@ func (job *ExportJob) Dump(out *zip.Writer, opt string) (int, int64, error) {
 		memberCount, memberSize, _ := job.dumpTable(out, "group_members", nil)
 		return count + groupCount + memberCount, size + groupSize + memberSize, nil
 	} else if opt == "media" {
-		// dump all local store files
-		uploadDir := carrot.GetValue(job.m.db, models.KEY_CMS_UPLOAD_DIR)
-
+		// dump all stored files, the shared file is dumped once
+		dumped := map[string]bool{}
 		return job.dumpTable(out, opt, func(out *zip.Writer, modelObj any) (int64, bool, error) {
 			media := modelObj.(*models.Media)
-			if media.External || media.Directory {
+			if media.External || media.Directory || dumped[media.StorePath] {
 				return 0, true, nil
 			}
 
@@ -380,17 +390,26 @@ func (job *ExportJob) Dump(out *zip.Writer, opt string) (int, int64, error) {
 				return 0, false, nil
 			}
 
-			fullPath := filepath.Join(uploadDir, media.StorePath)
-			fileData, err := os.ReadFile(fullPath)
+			storage, err := models.GetStorage(job.m.db, media.Storage)
+			if err != nil {
+				return 0, false, err
+			}
+			reader, err := storage.Get(media.StorePath)
 			if err != nil {
 				return 0, false, err
 			}
+			defer reader.Close()
+
 			f, err := out.Create(filepath.Join("media", media.StorePath))
 			if err != nil {
 				return 0, false, err
 			}
-			f.Write(fileData)
-			return int64(len(fileData)), true, nil
+			size, err := io.Copy(f, reader)
+			if err != nil {
+				return 0, false, err
+			}
+			dumped[media.StorePath] = true
+			return size, true, nil
 		})
 	}
 	return job.dumpTable(out, opt, nil)
@@ -423,7 +442,18 @@ func (job *ExportJob) Start() {
 			Author:      carrot.GetValue(job.m.db, carrot.KEY_SITE_ADMIN),
 		}
 
-		zipFile := bytes.NewBuffer(nil)
+		// the zip is written to a temp file, the media files may be huge
+		zipFile, err := os.CreateTemp("", "restcontent_export_*.zip")
+		if err != nil {
+			job.mutex.Lock()
+			job.result.Status = "error"
+			job.result.Reason = fmt.Sprintf("create tmp file %v", err.Error())
+			job.mutex.Unlock()
+			return
+		}
+		defer os.Remove(zipFile.Name())
+		defer zipFile.Close()
+
 		out := zip.NewWriter(zipFile)
 		for _, opt := range job.Options {
 			switch opt {
@@ -452,7 +482,17 @@ func (job *ExportJob) Start() {
 		metaData, _ := json.Marshal(&exportMeta)
 		meta, _ := out.Create("meta.json")
 		meta.Write([]byte(metaData))
-		out.Close()
+		err = out.Close()
+		if err == nil {
+			_, err = zipFile.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			job.mutex.Lock()
+			job.result.Status = "error"
+			job.result.Reason = fmt.Sprintf("write zip %v", err.Error())
+			job.mutex.Unlock()
+			return
+		}
 		// Save to media
 		r, err := models.UploadFile(job.m.db, "/", fmt.Sprintf("restcontent_export_%s.zip", job.key), zipFile)
 		if err != nil {
@@ -465,6 +505,9 @@ func (job *ExportJob) Start() {
 			media.Name = r.Name
 			media.Path = r.Path
 			media.StorePath = r.StorePath
+			media.Hash = r.Hash
+			media.External = r.External
+			media.Storage = r.Storage
 			media.Directory = false
 			media.Ext = r.Ext
 			media.ContentType = r.ContentType
@@ -0,0 +1,83 @@
+package restcontent
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/restsend/carrot"
+	"github.com/restsend/restcontent/models"
+)
+
+// GET /feed/:site/rss or /feed/:site/atom, query with category_id, category_path and tag
+func (m *Manager) handleFeed(c *gin.Context) {
+	format := c.Param("format")
+	if format != models.FeedFormatRss && format != models.FeedFormatAtom {
+		carrot.AbortWithJSONError(c, http.StatusNotFound, models.ErrInvalidFeedFormat)
+		return
+	}
+
+	site, err := models.GetSite(m.db, c.Param("site"))
+	if err != nil {
+		carrot.AbortWithJSONError(c, http.StatusNotFound, err)
+		return
+	}
+	if !checkApiScope(c, models.ApiScopeReadPost) {
+		return
+	}
+	if !m.canAccessSite(c, site) {
+		carrot.AbortWithJSONError(c, http.StatusNotFound, models.ErrSiteIsDisallow)
+		return
+	}
+
+	form := models.FeedForm{
+		SiteID:       site.Domain,
+		CategoryID:   c.Query("category_id"),
+		CategoryPath: c.Query("category_path"),
+		Tag:          c.Query("tag"),
+		Limit:        carrot.GetIntValue(m.db, models.KEY_CMS_FEED_SIZE, models.DefaultFeedSize),
+	}
+	if limit, err := strconv.Atoi(c.Query("limit")); err == nil && limit > 0 {
+		form.Limit = limit
+	}
+
+	posts, err := models.QueryFeedPosts(m.db, &form)
+	if err != nil {
+		carrot.AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	fullContent := carrot.GetBoolValue(m.db, models.KEY_CMS_FEED_FULL_CONTENT)
+	policy := models.GetHtmlPolicy(m.db)
+
+	var items []models.FeedItem
+	for i := range posts {
+		post := &posts[i]
+		item := models.FeedItem{
+			RenderContent: models.NewRenderContentFromPost(m.db, post, false),
+			Link:          site.BuildContentUrl(models.ContentNamePost, post.ID, post.CategoryID, post.CategoryPath),
+			Published:     post.CreatedAt,
+			Tags:          models.SplitTags(post.Tags),
+		}
+		if post.PublishedAt.Valid {
+			item.Published = post.PublishedAt.Time
+		}
+		if fullContent {
+			if err := item.RenderHtml(policy); err != nil {
+				carrot.Warning("render feed item failed:", post.SiteID, post.ID, err)
+			}
+			item.Content = policy.SanitizeBody(item.ContentType, item.PostBody)
+		}
+		items = append(items, item)
+	}
+
+	selfUrl := m.getRequestBaseUrl(c, "")
+	if c.Request.URL.RawQuery != "" {
+		selfUrl += "?" + c.Request.URL.RawQuery
+	}
+	if format == models.FeedFormatAtom {
+		renderXML(c, "application/atom+xml; charset=utf-8", models.NewAtomFeed(site, selfUrl, items))
+	} else {
+		renderXML(c, "application/rss+xml; charset=utf-8", models.NewRssFeed(site, selfUrl, items))
+	}
+}
@@ -1,8 +1,16 @@
 package restcontent
 
 import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
 	"net/http"
+	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/restsend/carrot"
@@ -10,6 +18,12 @@ import (
 	"gorm.io/gorm"
 )
 
+// The expires of redirect url when the media is in a private bucket
+const mediaSignedUrlExpires = 10 * time.Minute
+
+// Limit the concurrent image transforms, decoding large images is expensive
+var imageTransformLimit = make(chan struct{}, 4)
+
 func (m *Manager) getMediaObject() carrot.AdminObject {
 	return carrot.AdminObject{
 		Model:       &models.Media{},
@@ -17,16 +31,17 @@ func (m *Manager) getMediaObject() carrot.AdminObject {
 		Name:        "Media",
 		Desc:        "All kinds of media files, such as images, videos, audios, etc.",
 		Shows:       []string{"Name", "ContentType", "Author", "Published", "Size", "Dimensions", "UpdatedAt"},
-		Editables:   []string{"External", "PublicUrl", "Author", "Published", "PublishedAt", "Title", "Alt", "Description", "Keywords", "ContentType", "Size", "Path", "Name", "Dimensions", "StorePath", "UpdatedAt", "Ext", "Size", "StorePath", "Remark"},
-		Filterables: []string{"Published", "UpdatedAt", "ContentType", "External"},
+		Editables:   []string{"External", "PublicUrl", "Author", "Published", "PublishedAt", "Tags", "Title", "Alt", "Description", "Keywords", "ContentType", "Size", "SiteID", "Path", "Name", "Dimensions", "Storage", "StorePath", "Hash", "UpdatedAt", "Ext", "Size", "StorePath", "Remark"},
+		Filterables: []string{"SiteID", "Published", "UpdatedAt", "ContentType", "External", "Storage"},
 		Orderables:  []string{"UpdatedAt", "PublishedAt", "Size"},
-		Searchables: []string{"Title", "Alt", "Description", "Keywords", "Path", "Path", "Name", "StorePath"},
+		Searchables: []string{"Title", "Alt", "Description", "Keywords", "Path", "Path", "Name", "StorePath", "Hash"},
 		Requireds:   []string{"ContentType", "Size", "Path", "Name", "Dimensions", "StorePath"},
 		Icon:        readIcon("./icon/image.svg"),
 		Attributes: map[string]carrot.AdminAttribute{
 			"ContentType": {Choices: models.ContentTypes},
+			"Storage":     {Choices: models.StorageTypes},
 			"Size":        {Widget: "humanize-size"},
-			"Site":        {SingleChoice: true},
+			"Tags":        {Widget: "tags", FilterWidget: "tags"},
 		},
 		Scripts: []carrot.AdminScript{
 			{Src: "./js/cms_widget.js"},
@@ -39,25 +54,10 @@ func (m *Manager) getMediaObject() carrot.AdminObject {
 				Op:   carrot.OrderOpAsc,
 			},
 		},
-		BeforeRender: func(db *gorm.DB, ctx *gin.Context, vptr any) (any, error) {
-			media := vptr.(*models.Media)
-			mediaHost := carrot.GetValue(db, models.KEY_CMS_MEDIA_HOST)
-			mediaPrefix := carrot.GetValue(db, models.KEY_CMS_MEDIA_PREFIX)
-			media.BuildPublicUrls(mediaHost, mediaPrefix)
-			return vptr, nil
-		},
-		BeforeCreate: func(db *gorm.DB, ctx *gin.Context, vptr any) error {
-			media := vptr.(*models.Media)
-			media.Creator = *carrot.CurrentUser(ctx)
-			return nil
-		},
-		BeforeDelete: func(db *gorm.DB, ctx *gin.Context, vptr any) error {
-			media := vptr.(*models.Media)
-			if err := models.RemoveFile(db, media.Path, media.Name); err != nil {
-				carrot.Warning("Delete file failed: ", media.StorePath, err)
-			}
-			return nil
-		},
+		BeforeRender: m.beforeRenderMedia,
+		BeforeCreate: m.beforeCreateMedia,
+		BeforeUpdate: m.beforeUpdateMedia,
+		BeforeDelete: m.beforeDeleteMedia,
 		Actions: []carrot.AdminAction{
 			{
 				Path: "make_publish",
@@ -73,6 +73,28 @@ func (m *Manager) getMediaObject() carrot.AdminObject {
 					return m.handleMakeMediaPublish(db, c, obj, false)
 				},
 			},
+			{
+				Path:    "signed_url",
+				Name:    "Signed URL",
+				Handler: m.handleSignedMediaURL,
+			},
+			{
+				Path:    "used_by",
+				Name:    "Used By",
+				Handler: m.handleMediaUsages,
+			},
+			{
+				WithoutObject: true,
+				Path:          "orphans",
+				Name:          "Orphan Files",
+				Handler:       m.handleOrphanMedia,
+			},
+			{
+				WithoutObject: true,
+				Path:          "rebuild_media_references",
+				Name:          "Rebuild Media References",
+				Handler:       m.handleRebuildMediaReferences,
+			},
 			{
 				WithoutObject: true,
 				Path:          "folders",
@@ -91,6 +113,32 @@ func (m *Manager) getMediaObject() carrot.AdminObject {
 				Name:          "Upload",
 				Handler:       m.handleUpload,
 			},
+			{
+				WithoutObject: true,
+				Path:          "upload_create",
+				Name:          "Create Upload",
+				Handler:       m.handleUploadCreate,
+			},
+			{
+				WithoutObject: true,
+				Path:          "upload_chunk",
+				Name:          "Upload Chunk",
+				Handler:       m.handleUploadChunk,
+			},
+			{
+				WithoutObject: true,
+				Path:          "upload_status",
+				Name:          "Upload Status",
+				Handler:       m.handleUploadStatus,
+			},
+			{
+				WithoutObject: true,
+				Path:          "upload_finish",
+				Name:          "Finish Upload",
+				Handler: func(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+					return m.handleUploadFinish(db, c, c.Query("created") != "")
+				},
+			},
 			{
 				WithoutObject: true,
 				Path:          "remove_dir",
@@ -101,22 +149,98 @@ func (m *Manager) getMediaObject() carrot.AdminObject {
 	}
 }
 
+// Check the permission of media in the library of site, the empty site is the shared library
+func checkMediaPermission(db *gorm.DB, c *gin.Context, siteId, perm string) error {
+	if err := checkSiteScope(c, siteId); err != nil {
+		return err
+	}
+	return checkPermission(db, c, siteId, models.ContentNameMedia, perm)
+}
+
+func (m *Manager) beforeCreateMedia(db *gorm.DB, ctx *gin.Context, vptr any) error {
+	media := vptr.(*models.Media)
+	if err := checkMediaPermission(db, ctx, media.SiteID, models.PermCreate); err != nil {
+		return err
+	}
+	if user := getRequestUser(ctx); user != nil {
+		media.Creator = *user
+	}
+	return models.SyncContentTags(db, models.ContentNameMedia, media.SiteID, models.MediaContentID(media.Path, media.Name), media.Tags)
+}
+
+func (m *Manager) beforeUpdateMedia(db *gorm.DB, ctx *gin.Context, vptr any, vals map[string]any) error {
+	media := vptr.(*models.Media)
+	if err := checkMediaPermission(db, ctx, media.SiteID, models.PermUpdate); err != nil {
+		return err
+	}
+	if tags, ok := vals["tags"].(string); ok {
+		return models.SyncContentTags(db, models.ContentNameMedia, media.SiteID, models.MediaContentID(media.Path, media.Name), tags)
+	}
+	return nil
+}
+
+func (m *Manager) beforeDeleteMedia(db *gorm.DB, ctx *gin.Context, vptr any) error {
+	media := vptr.(*models.Media)
+	if err := checkMediaPermission(db, ctx, media.SiteID, models.PermDelete); err != nil {
+		return err
+	}
+	if !media.Directory && ctx.Query("force") == "" {
+		if count, err := models.CountMediaUsages(db, media.SiteID, media.Path, media.Name); err != nil {
+			return err
+		} else if count > 0 {
+			return models.ErrMediaInUse
+		}
+	}
+	if err := models.RemoveFile(db, media.SiteID, media.Path, media.Name); err != nil {
+		carrot.Warning("Delete file failed: ", media.StorePath, err)
+	}
+	if err := models.RemoveContentTags(db, models.ContentNameMedia, media.SiteID, models.MediaContentID(media.Path, media.Name)); err != nil {
+		return err
+	}
+	queueWebhook(ctx, models.GetEventName(models.ContentNameMedia, models.EventDelete), media.SiteID, map[string]any{"siteId": media.SiteID, "path": media.Path, "name": media.Name})
+	return nil
+}
+
+func (m *Manager) beforeRenderMedia(db *gorm.DB, ctx *gin.Context, vptr any) (any, error) {
+	media := vptr.(*models.Media)
+	mediaHost := carrot.GetValue(db, models.KEY_CMS_MEDIA_HOST)
+	mediaPrefix := carrot.GetValue(db, models.KEY_CMS_MEDIA_PREFIX)
+	media.BuildPublicUrls(mediaHost, mediaPrefix)
+	return vptr, nil
+}
+
 func (m *Manager) handleListFolders(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+	siteId := c.Query("site_id")
 	path := c.Query("path")
-	return models.ListFolders(db, path)
+	if siteId != "" {
+		if err := checkSiteScope(c, siteId); err != nil {
+			return nil, err
+		}
+	}
+	return models.ListFolders(db, siteId, path)
 }
 
 func (m *Manager) handleNewFolder(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+	siteId := c.Query("site_id")
 	path := c.Query("path")
 	name := c.Query("name")
-	user := carrot.CurrentUser(c)
-	return models.CreateFolder(db, path, name, user)
+	if err := checkMediaPermission(db, c, siteId, models.PermCreate); err != nil {
+		return nil, err
+	}
+	user := getRequestUser(c)
+	return models.CreateFolder(db, siteId, path, name, user)
 }
 
 func (m *Manager) handleMakeMediaPublish(db *gorm.DB, c *gin.Context, obj any, publish bool) (any, error) {
 	siteId := c.Query("site_id")
 	path := c.Query("path")
 	name := c.Query("name")
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	if err := checkMediaPermission(db, c, siteId, models.PermPublish); err != nil {
+		return false, err
+	}
 
 	if err := models.MakeMediaPublish(db, siteId, path, name, obj, publish); err != nil {
 		carrot.Warning("Make publish failed:", siteId, path, name, publish, err)
@@ -125,29 +249,276 @@ func (m *Manager) handleMakeMediaPublish(db *gorm.DB, c *gin.Context, obj any, p
 	return true, nil
 }
 
+// The url of media with signature, the unpublished media can be shared by the url until expired,
+// the url is served without auth, and downloaded as filename when it's not empty
+//
+//	POST signed_url?site_id=&path=&name=&expires=&filename=
+func (m *Manager) handleSignedMediaURL(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+	media, ok := obj.(*models.Media)
+	if !ok || c.Query("name") != "" {
+		path := c.Query("path")
+		if len(path) > 1 {
+			path = strings.TrimSuffix(path, "/")
+		}
+		var err error
+		if media, err = models.GetMedia(db, c.Query("site_id"), path, c.Query("name")); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkMediaPermission(db, c, media.SiteID, models.PermUpdate); err != nil {
+		return nil, err
+	}
+	expires, _ := strconv.Atoi(c.Query("expires"))
+	return models.BuildSignedMediaURL(db, media, expires, c.Query("filename"))
+}
+
+// The pages and posts which use the media, query with site_id, path and name
+func (m *Manager) handleMediaUsages(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+	siteId := c.Query("site_id")
+	path := c.Query("path")
+	name := c.Query("name")
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	if media, ok := obj.(*models.Media); ok && name == "" {
+		siteId, path, name = media.SiteID, media.Path, media.Name
+	}
+	return models.GetMediaUsages(db, siteId, path, name)
+}
+
+// The files which are not used by any page or post, run Rebuild Media References first
+// if the references are out of date
+func (m *Manager) handleOrphanMedia(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+	return models.ListOrphanMedia(db)
+}
+
+func (m *Manager) handleRebuildMediaReferences(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+	count, err := models.RebuildMediaReferences(db)
+	if err != nil {
+		carrot.Warning("rebuild media references failed:", err)
+		return false, err
+	}
+	return count, nil
+}
+
 func (m *Manager) handleMedia(c *gin.Context) {
 	fullPath := c.Param("filepath")
-	path, name := filepath.Split(fullPath)
-	img, err := models.GetMedia(m.db, path, name)
+	siteId, path, name := models.ParseMediaFullPath(fullPath)
+	img, err := models.GetMedia(m.db, siteId, path, name)
+	if err != nil && siteId != "" {
+		// the folder of shared library which is named like a site
+		path, name = filepath.Split(fullPath)
+		img, err = models.GetMedia(m.db, "", path, name)
+	}
 	if err != nil {
 		carrot.AbortWithJSONError(c, http.StatusNotFound, err)
 		return
 	}
+	// the media of disallowed site or out of the site scope is the same as not exists,
+	// the signed url is checked too
+	if !m.canAccessMedia(c, img) {
+		carrot.AbortWithJSONError(c, http.StatusNotFound, gorm.ErrRecordNotFound)
+		return
+	}
+
+	signed := false
+	if c.Query(models.MediaQuerySignature) != "" {
+		if err := models.VerifyMediaSignature(m.db, img, c.Request.URL.Query(), time.Now()); err != nil {
+			if !img.Published {
+				// the unpublished media is the same as not exists
+				carrot.AbortWithJSONError(c, http.StatusNotFound, gorm.ErrRecordNotFound)
+			} else {
+				carrot.AbortWithJSONError(c, http.StatusForbidden, err)
+			}
+			return
+		}
+		signed = true
+	}
+
+	if !img.Published && !signed && !isStaffRequest(c) {
+		// the unpublished media is the same as not exists
+		carrot.AbortWithJSONError(c, http.StatusNotFound, gorm.ErrRecordNotFound)
+		return
+	}
+	if !img.Published || signed {
+		c.Header("Cache-Control", "private, no-store")
+	}
+	filename := ""
+	if signed {
+		filename = c.Query(models.MediaQueryFilename)
+	}
+	if filename != "" {
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	}
 
 	if img.External {
 		c.Redirect(http.StatusFound, img.StorePath)
 		return
 	}
 
-	uploadDir := carrot.GetValue(m.db, models.KEY_CMS_UPLOAD_DIR)
-	filepath := filepath.Join(uploadDir, img.StorePath)
-	http.ServeFile(c.Writer, c.Request, filepath)
+	storage, err := models.GetStorage(m.db, img.Storage)
+	if err != nil {
+		carrot.AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	if c.Query("w") != "" || c.Query("h") != "" || c.Query("format") != "" || c.Query("q") != "" {
+		m.serveImageTransform(c, img, storage)
+		return
+	}
+
+	key := img.StorePath
+	if name := c.Query("variant"); name != "" {
+		// fallback to the original when the image is smaller than variant
+		if variant, ok := img.Variants[name]; ok {
+			key = models.GetVariantStorePath(img.StorePath, name, variant.Ext)
+		}
+	}
+
+	// the public url of storage is never expired, so it's only for the published media,
+	// and the download filename is lost by redirect
+	if url := storage.PublicURL(key); url != "" && img.Published && filename == "" {
+		c.Redirect(http.StatusFound, url)
+		return
+	}
+	if url, err := storage.SignedURL(key, mediaSignedUrlExpires); err == nil && filename == "" {
+		c.Redirect(http.StatusFound, url)
+		return
+	}
+	serveStorageObject(c, storage, key)
+}
+
+// The unpublished media is served to the staff, the others need a signed url
+// Check the request can read the media of site, the shared library is readable by all
+func (m *Manager) canAccessMedia(c *gin.Context, media *models.Media) bool {
+	if media.SiteID == "" {
+		return true
+	}
+	site, err := models.GetSite(m.db, media.SiteID)
+	if err != nil {
+		return false
+	}
+	return m.canAccessSite(c, site)
+}
+
+func isStaffRequest(c *gin.Context) bool {
+	user := getRequestUser(c)
+	return user != nil && (user.IsStaff || user.IsSuperUser)
+}
+
+// Resize and encode the image by query, the result is cached in disk by the options
+func (m *Manager) serveImageTransform(c *gin.Context, img *models.Media, storage models.Storage) {
+	switch img.Ext {
+	case ".jpg", ".jpeg", ".png", ".gif":
+	default:
+		carrot.AbortWithJSONError(c, http.StatusBadRequest, models.ErrUnsupportedImageFormat)
+		return
+	}
+	allowSizes := models.ParseImageSizeList(carrot.GetValue(m.db, models.KEY_CMS_IMAGE_TRANSFORM_SIZES))
+	if len(allowSizes) == 0 {
+		carrot.AbortWithJSONError(c, http.StatusBadRequest, models.ErrImageSizeNotAllowed)
+		return
+	}
+	t, err := models.ParseImageTransform(c.Query("w"), c.Query("h"), c.Query("fit"), c.Query("format"), c.Query("q"), allowSizes)
+	if err != nil {
+		carrot.AbortWithJSONError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	cacheName := t.CacheName(img.Ext)
+	cacheDir := models.GetImageCacheDir(m.db, storage.Name(), img.StorePath)
+	cachePath := filepath.Join(cacheDir, cacheName)
+	if cacheDir != "" {
+		if _, err := os.Stat(cachePath); err == nil {
+			c.File(cachePath)
+			return
+		}
+	}
+
+	imageTransformLimit <- struct{}{}
+	defer func() { <-imageTransformLimit }()
+
+	reader, err := storage.Get(img.StorePath)
+	if err != nil {
+		carrot.AbortWithJSONError(c, http.StatusNotFound, err)
+		return
+	}
+	defer reader.Close()
+
+	buf := new(bytes.Buffer)
+	if err := t.Transform(buf, reader, img.Ext); err != nil {
+		if errors.Is(err, models.ErrImageTooLarge) {
+			carrot.AbortWithJSONError(c, http.StatusBadRequest, err)
+			return
+		}
+		carrot.Warning("transform image failed: ", img.Path, img.Name, err)
+		carrot.AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+	if cacheDir != "" {
+		if err := writeFileAtomic(cachePath, buf.Bytes()); err != nil {
+			carrot.Warning("write image cache failed: ", cachePath, err)
+		}
+	}
+	c.Data(http.StatusOK, mime.TypeByExtension(filepath.Ext(cacheName)), buf.Bytes())
+}
+
+// Write to a temp file then rename, the readers never see a partial file
+func writeFileAtomic(name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(name), ".tmp_*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+// Serve the file of storage, the range request is supported when the storage is seekable
+func serveStorageObject(c *gin.Context, storage models.Storage, key string) {
+	obj, err := storage.Stat(key)
+	if err != nil {
+		carrot.AbortWithJSONError(c, http.StatusNotFound, err)
+		return
+	}
+	reader, err := storage.Get(key)
+	if err != nil {
+		carrot.AbortWithJSONError(c, http.StatusNotFound, err)
+		return
+	}
+	defer reader.Close()
+
+	if rs, ok := reader.(io.ReadSeeker); ok {
+		http.ServeContent(c.Writer, c.Request, key, obj.ModTime, rs)
+		return
+	}
+	c.DataFromReader(http.StatusOK, obj.Size, obj.ContentType, reader, nil)
 }
 
 func (m *Manager) handleRemoveDirectory(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+	siteId := c.Query("site_id")
 	path := c.Query("path")
+	if err := checkMediaPermission(db, c, siteId, models.PermDelete); err != nil {
+		return nil, err
+	}
+	if c.Query("force") == "" {
+		if count, err := models.CountDirectoryUsages(db, siteId, path); err != nil {
+			return nil, err
+		} else if count > 0 {
+			return nil, models.ErrMediaInUse
+		}
+	}
 
-	parent, err := models.RemoveDirectory(db, path)
+	parent, err := models.RemoveDirectory(db, siteId, path)
 	if err != nil {
 		carrot.AbortWithJSONError(c, http.StatusInternalServerError, err)
 		return nil, err
@@ -156,16 +527,18 @@ func (m *Manager) handleRemoveDirectory(db *gorm.DB, c *gin.Context, obj any) (a
 }
 
 func (m *Manager) handleUpload(db *gorm.DB, c *gin.Context, obj any) (any, error) {
-	created := c.Query("created")
-	path := c.Query("path")
-	name := c.Query("name")
+	return m.uploadMedia(db, c, c.Query("created") != "")
+}
 
-	file, err := c.FormFile("file")
-	if err != nil {
+func (m *Manager) uploadMedia(db *gorm.DB, c *gin.Context, created bool) (*models.UploadResult, error) {
+	siteId := c.Query("site_id")
+	if err := checkMediaPermission(db, c, siteId, models.PermCreate); err != nil {
 		return nil, err
 	}
+	path := c.Query("path")
+	name := c.Query("name")
 
-	mFile, err := file.Open()
+	mFile, filename, err := openUploadFile(c)
 	if err != nil {
 		return nil, err
 	}
@@ -175,23 +548,33 @@ func (m *Manager) handleUpload(db *gorm.DB, c *gin.Context, obj any) (any, error
 		path = "/"
 	}
 	if name == "" {
-		name = file.Filename
+		name = filename
 	}
-	r, err := models.UploadFile(db, path, name, mFile)
+	return m.createUploadedMedia(db, c, siteId, path, name, mFile, created)
+}
+
+// Store the file and create the media, the media row is not created when created is false
+func (m *Manager) createUploadedMedia(db *gorm.DB, c *gin.Context, siteId, path, name string, reader io.Reader, created bool) (*models.UploadResult, error) {
+	r, err := models.UploadFile(db, path, name, reader)
 	if err != nil {
 		return nil, err
 	}
+	r.SiteID = siteId
 
 	var media models.Media
 
-	user := carrot.CurrentUser(c)
+	user := getRequestUser(c)
+	media.SiteID = r.SiteID
 	media.Name = r.Name
 	media.Path = r.Path
 	media.External = r.External
+	media.Storage = r.Storage
 	media.StorePath = r.StorePath
+	media.Hash = r.Hash
 	media.Size = r.Size
 	media.ContentType = r.ContentType
 	media.Dimensions = r.Dimensions
+	media.Variants = r.Variants
 	media.Directory = false
 	media.Ext = r.Ext
 	media.ContentType = r.ContentType
@@ -202,7 +585,7 @@ func (m *Manager) handleUpload(db *gorm.DB, c *gin.Context, obj any) (any, error
 		media.CreatorID = user.ID
 	}
 
-	if created != "" {
+	if created {
 		result := db.Create(&media)
 		if result.Error != nil {
 			return nil, result.Error
@@ -215,6 +598,41 @@ func (m *Manager) handleUpload(db *gorm.DB, c *gin.Context, obj any) (any, error
 
 	r.PublicUrl = media.PublicUrl
 	r.Thumbnail = media.Thumbnail
+	r.Srcset = media.Srcset
+	if created {
+		queueWebhook(c, models.GetEventName(models.ContentNameMedia, models.EventUpload), r.SiteID, r)
+	}
 
 	return r, nil
 }
+
+// Open the file field of multipart form, the body is streamed without buffering unless it's parsed
+func openUploadFile(c *gin.Context) (io.ReadCloser, string, error) {
+	if c.Request.MultipartForm == nil {
+		if mr, err := c.Request.MultipartReader(); err == nil {
+			for {
+				part, err := mr.NextPart()
+				if err == io.EOF {
+					return nil, "", http.ErrMissingFile
+				}
+				if err != nil {
+					return nil, "", err
+				}
+				if part.FormName() == "file" {
+					return part, part.FileName(), nil
+				}
+				part.Close()
+			}
+		}
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return nil, "", err
+	}
+	f, err := file.Open()
+	if err != nil {
+		return nil, "", err
+	}
+	return f, file.Filename, nil
+}
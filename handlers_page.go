@@ -2,7 +2,9 @@ package restcontent
 
 import (
 	"net/http"
+	"sort"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/restsend/carrot"
@@ -23,9 +25,9 @@ func (m *Manager) getPageObject() carrot.AdminObject {
 		Group:       "Contents",
 		Name:        "Page",
 		Desc:        "The page data of the website can only be in JSON/YAML format",
-		Shows:       []string{"ID", "Site", "Title", "Author", "IsDraft", "Published", "PublishedAt", "CategoryID", "Tags", "CreatedAt"},
-		Editables:   []string{"ID", "Site", "CategoryID", "CategoryPath", "Author", "IsDraft", "Draft", "Published", "PublishedAt", "ContentType", "Thumbnail", "Tags", "Title", "Alt", "Description", "Keywords", "Draft", "Remark"},
-		Filterables: []string{"Site", "CategoryID", "Tags", "Published", "UpdatedAt"},
+		Shows:       []string{"ID", "Site", "Title", "Author", "IsDraft", "State", "Published", "PublishedAt", "CategoryID", "Tags", "CreatedAt"},
+		Editables:   []string{"ID", "Site", "CategoryID", "CategoryPath", "Author", "IsDraft", "Draft", "Published", "PublishedAt", "ScheduledAt", "UnpublishAt", "ContentType", "Thumbnail", "Tags", "Title", "Alt", "Description", "Keywords", "Draft", "Remark"},
+		Filterables: []string{"Site", "CategoryID", "Tags", "State", "Published", "UpdatedAt"},
 		Orderables:  []string{"UpdatedAt", "PublishedAt"},
 		Searchables: []string{"ID", "Tags", "Title", "Alt", "Description", "Keywords", "Body"},
 		Requireds:   []string{"ID", "Site", "CategoryID", "ContentType", "Body"},
@@ -39,9 +41,11 @@ func (m *Manager) getPageObject() carrot.AdminObject {
 			{Src: "./js/cms_page.js", Onload: true}},
 		Attributes: map[string]carrot.AdminAttribute{
 			"ContentType": {Choices: enabledPageContentTypes, Default: models.ContentTypeJson},
+			"State":       {Choices: models.WorkflowStates},
 			"Draft":       {Default: "{}"},
 			"IsDraft":     {Widget: "is-draft"},
 			"Published":   {Widget: "is-published"},
+			"ScheduledAt": {Help: "The draft is published at the time, the live content is kept until then"},
 			"Tags":        {Widget: "tags", FilterWidget: "tags"},
 			"CategoryID":  {Widget: "category-id-and-path", FilterWidget: "category-id-and-path"},
 			"ID":          {Help: "ID must be unique,recommend use page url eg: about-us"},
@@ -88,29 +92,90 @@ func (m *Manager) getPageObject() carrot.AdminObject {
 				Path:          "tags",
 				Name:          "Query All Tags",
 				Handler: func(db *gorm.DB, c *gin.Context, obj any) (any, error) {
-					return m.handleQueryTags(db, c, obj, "pages")
+					return m.handleQueryTags(db, c, obj, models.ContentNamePage)
 				},
 			},
+			{
+				Path: "revisions",
+				Name: "Revisions",
+				Handler: func(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+					return m.handleListRevisions(db, c, obj)
+				},
+			},
+			{
+				Path: "diff_revisions",
+				Name: "Diff Revisions",
+				Handler: func(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+					return m.handleDiffRevisions(db, c, obj)
+				},
+			},
+			{
+				Path: "restore_revision",
+				Name: "Restore Revision",
+				Handler: func(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+					return m.handleRestoreRevision(db, c, obj)
+				},
+			},
+			{
+				Path: "submit_review",
+				Name: "Submit for Review",
+				Handler: func(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+					return m.handleWorkflow(db, c, obj, models.WorkflowSubmit)
+				},
+			},
+			{
+				Path: "approve",
+				Name: "Approve",
+				Handler: func(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+					return m.handleWorkflow(db, c, obj, models.WorkflowApprove)
+				},
+			},
+			{
+				Path: "reject",
+				Name: "Reject",
+				Handler: func(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+					return m.handleWorkflow(db, c, obj, models.WorkflowReject)
+				},
+			},
+			{
+				Path: "archive",
+				Name: "Archive",
+				Handler: func(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+					return m.handleWorkflow(db, c, obj, models.WorkflowArchive)
+				},
+			},
+			{
+				Path: "restore",
+				Name: "Restore from Archive",
+				Handler: func(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+					return m.handleWorkflow(db, c, obj, models.WorkflowRestore)
+				},
+			},
+			{
+				Path: "review_logs",
+				Name: "Review Logs",
+				Handler: func(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+					return m.handleListReviewLogs(db, c, obj)
+				},
+			},
+			{
+				WithoutObject: true,
+				Path:          "review_queue",
+				Name:          "Review Queue",
+				Handler: func(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+					return m.handleReviewQueue(db, c, obj, models.ContentNamePage)
+				},
+			},
+			{
+				WithoutObject: true,
+				Path:          "rebuild_search_index",
+				Name:          "Rebuild Search Index",
+				Handler:       m.handleRebuildSearchIndex,
+			},
 		},
-		BeforeCreate: func(db *gorm.DB, ctx *gin.Context, vptr any) error {
-			page := vptr.(*models.Page)
-			page.ContentType = models.ContentTypeJson
-			page.Creator = *carrot.CurrentUser(ctx)
-			page.IsDraft = true
-			return nil
-		},
-		BeforeUpdate: func(db *gorm.DB, ctx *gin.Context, vptr any, vals map[string]any) error {
-			page := vptr.(*models.Page)
-			page.IsDraft = true
-			if _, ok := vals["published"]; ok {
-				page.Published = vals["published"].(bool)
-				if page.Published {
-					page.Body = page.Draft
-					page.IsDraft = false
-				}
-			}
-			return nil
-		},
+		BeforeCreate: m.beforeCreatePage,
+		BeforeUpdate: m.beforeUpdatePage,
+		BeforeDelete: m.beforeDeletePage,
 	}
 }
 
@@ -120,9 +185,9 @@ func (m *Manager) getPostObject() carrot.AdminObject {
 		Group:       "Contents",
 		Name:        "Post",
 		Desc:        "Website articles or blogs, support HTML and Markdown formats",
-		Shows:       []string{"ID", "Site", "Title", "Author", "CategoryID", "Tags", "IsDraft", "Published", "PublishedAt", "CreatedAt"},
-		Editables:   []string{"ID", "Site", "CategoryID", "CategoryPath", "Author", "IsDraft", "Draft", "Published", "PublishedAt", "ContentType", "Thumbnail", "Tags", "Title", "Alt", "Description", "Keywords", "Draft", "Remark"},
-		Filterables: []string{"Site", "CategoryID", "Tags", "Published", "UpdatedAt"},
+		Shows:       []string{"ID", "Site", "Title", "Author", "CategoryID", "Tags", "IsDraft", "State", "Published", "PublishedAt", "CreatedAt"},
+		Editables:   []string{"ID", "Site", "CategoryID", "CategoryPath", "Author", "IsDraft", "Draft", "Published", "PublishedAt", "ScheduledAt", "UnpublishAt", "ContentType", "Thumbnail", "Tags", "Title", "Alt", "Description", "Keywords", "Draft", "Remark"},
+		Filterables: []string{"Site", "CategoryID", "Tags", "State", "Published", "UpdatedAt"},
 		Orderables:  []string{"UpdatedAt", "PublishedAt"},
 		Searchables: []string{"ID", "Tags", "Title", "Alt", "Description", "Keywords", "Body"},
 		Requireds:   []string{"ID", "Site", "CategoryID", "ContentType", "Body"},
@@ -138,9 +203,11 @@ func (m *Manager) getPostObject() carrot.AdminObject {
 			{Src: "./js/cms_page.js", Onload: true}},
 		Attributes: map[string]carrot.AdminAttribute{
 			"ContentType": {Choices: enabledPageContentTypes, Default: models.ContentTypeHtml},
+			"State":       {Choices: models.WorkflowStates},
 			"Draft":       {Default: "Your content ..."},
 			"IsDraft":     {Widget: "is-draft"},
 			"Published":   {Widget: "is-published"},
+			"ScheduledAt": {Help: "The draft is published at the time, the live content is kept until then"},
 			"Tags":        {Widget: "tags", FilterWidget: "tags"},
 			"CategoryID":  {Widget: "category-id-and-path", FilterWidget: "category-id-and-path"},
 			"ID":          {Help: "ID must be unique,recommend use title slug eg: hello-world-2023"},
@@ -187,38 +254,369 @@ func (m *Manager) getPostObject() carrot.AdminObject {
 				Path:          "tags",
 				Name:          "Query All Tags",
 				Handler: func(db *gorm.DB, c *gin.Context, obj any) (any, error) {
-					return m.handleQueryTags(db, c, obj, "posts")
+					return m.handleQueryTags(db, c, obj, models.ContentNamePost)
 				},
 			},
+			{
+				Path: "revisions",
+				Name: "Revisions",
+				Handler: func(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+					return m.handleListRevisions(db, c, obj)
+				},
+			},
+			{
+				Path: "diff_revisions",
+				Name: "Diff Revisions",
+				Handler: func(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+					return m.handleDiffRevisions(db, c, obj)
+				},
+			},
+			{
+				Path: "restore_revision",
+				Name: "Restore Revision",
+				Handler: func(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+					return m.handleRestoreRevision(db, c, obj)
+				},
+			},
+			{
+				Path: "submit_review",
+				Name: "Submit for Review",
+				Handler: func(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+					return m.handleWorkflow(db, c, obj, models.WorkflowSubmit)
+				},
+			},
+			{
+				Path: "approve",
+				Name: "Approve",
+				Handler: func(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+					return m.handleWorkflow(db, c, obj, models.WorkflowApprove)
+				},
+			},
+			{
+				Path: "reject",
+				Name: "Reject",
+				Handler: func(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+					return m.handleWorkflow(db, c, obj, models.WorkflowReject)
+				},
+			},
+			{
+				Path: "archive",
+				Name: "Archive",
+				Handler: func(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+					return m.handleWorkflow(db, c, obj, models.WorkflowArchive)
+				},
+			},
+			{
+				Path: "restore",
+				Name: "Restore from Archive",
+				Handler: func(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+					return m.handleWorkflow(db, c, obj, models.WorkflowRestore)
+				},
+			},
+			{
+				Path: "review_logs",
+				Name: "Review Logs",
+				Handler: func(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+					return m.handleListReviewLogs(db, c, obj)
+				},
+			},
+			{
+				WithoutObject: true,
+				Path:          "review_queue",
+				Name:          "Review Queue",
+				Handler: func(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+					return m.handleReviewQueue(db, c, obj, models.ContentNamePost)
+				},
+			},
+			{
+				WithoutObject: true,
+				Path:          "rebuild_search_index",
+				Name:          "Rebuild Search Index",
+				Handler:       m.handleRebuildSearchIndex,
+			},
 		},
-		BeforeCreate: func(db *gorm.DB, ctx *gin.Context, vptr any) error {
-			post := vptr.(*models.Post)
-			if post.ContentType == "" {
-				post.ContentType = models.ContentTypeMarkdown
+		BeforeCreate: m.beforeCreatePost,
+		BeforeUpdate: m.beforeUpdatePost,
+		BeforeDelete: m.beforeDeletePost,
+	}
+}
+
+func (m *Manager) beforeCreatePage(db *gorm.DB, ctx *gin.Context, vptr any) error {
+	page := vptr.(*models.Page)
+	if err := checkSiteScope(ctx, page.SiteID); err != nil {
+		return err
+	}
+	if err := checkPermission(db, ctx, page.SiteID, models.ContentNamePage, models.PermCreate); err != nil {
+		return err
+	}
+	page.ContentType = models.ContentTypeJson
+	if user := getRequestUser(ctx); user != nil {
+		page.Creator = *user
+	}
+	page.IsDraft = true
+	page.Draft = models.SanitizeOnSave(db, page.ContentType, page.Draft)
+	if err := models.SyncContentTags(db, models.ContentNamePage, page.SiteID, page.ID, page.Tags); err != nil {
+		return err
+	}
+	if err := models.UpdateMediaReferences(db, page); err != nil {
+		return err
+	}
+	queueWebhook(ctx, models.GetEventName(models.ContentNamePage, models.EventCreate), page.SiteID, page)
+	return nil
+}
+
+func (m *Manager) beforeUpdatePage(db *gorm.DB, ctx *gin.Context, vptr any, vals map[string]any) error {
+	page := vptr.(*models.Page)
+	if err := checkPermission(db, ctx, page.SiteID, models.ContentNamePage, models.PermUpdate); err != nil {
+		return err
+	}
+	if siteId, ok := vals["site_id"].(string); ok {
+		if err := checkSiteScope(ctx, siteId); err != nil {
+			return err
+		}
+		if err := checkPermission(db, ctx, siteId, models.ContentNamePage, models.PermCreate); err != nil {
+			return err
+		}
+	}
+	page.IsDraft = true
+	if draft, ok := vals["draft"].(string); ok {
+		contentType := page.ContentType
+		if val, ok := vals["content_type"].(string); ok {
+			contentType = val
+		}
+		page.Draft = models.SanitizeOnSave(db, contentType, draft)
+		vals["draft"] = page.Draft
+		if page.GetState() != models.StateDraft && page.GetState() != models.StateArchived {
+			// the draft is changed, the review must start over
+			page.State = models.StateDraft
+			vals["state"] = page.State
+		}
+	}
+	if tags, ok := vals["tags"].(string); ok {
+		if err := models.SyncContentTags(db, models.ContentNamePage, page.SiteID, page.ID, tags); err != nil {
+			return err
+		}
+	}
+	if body, ok := vals["body"].(string); ok {
+		page.Body = body
+	}
+	if thumbnail, ok := vals["thumbnail"].(string); ok {
+		page.Thumbnail = thumbnail
+	}
+	// the form sends the current value on every save, only the change needs to publish
+	if published, ok := vals["published"].(bool); ok && published != page.Published {
+		if err := checkPermission(db, ctx, page.SiteID, models.ContentNamePage, models.PermPublish); err != nil {
+			return err
+		}
+		fromState := page.GetState()
+		if published {
+			if err := models.CheckCanPublish(db, page); err != nil {
+				return err
 			}
-			post.Creator = *carrot.CurrentUser(ctx)
-			post.IsDraft = true
-			return nil
-		},
-		BeforeUpdate: func(db *gorm.DB, ctx *gin.Context, vptr any, vals map[string]any) error {
-			post := vptr.(*models.Post)
-			post.IsDraft = true
-			if _, ok := vals["published"]; ok {
-				post.Published = vals["published"].(bool)
-				if post.Published {
-					post.Body = post.Draft
-					post.IsDraft = false
+		}
+		page.Published = published
+		if page.Published {
+			page.State = models.StatePublished
+			vals["state"] = page.State
+			if err := models.CreateReviewLog(db, page, models.WorkflowPublish, fromState, page.State, "", getRequestUser(ctx)); err != nil {
+				return err
+			}
+			page.Body = models.SanitizeOnSave(db, page.ContentType, page.Draft)
+			page.IsDraft = false
+			vals["body"] = page.Body
+			vals["is_draft"] = page.IsDraft
+			// the snapshot is taken from the written row, the other fields may change in the same update
+			siteID, ID, user := page.SiteID, page.ID, getRequestUser(ctx)
+			if val, ok := vals["site_id"].(string); ok {
+				siteID = val
+			}
+			afterWrite(ctx, func(db *gorm.DB) {
+				if err := models.CreatePublishLogFromDB(db, &models.Page{}, siteID, ID, user); err != nil {
+					carrot.Warning("create publish log failed:", siteID, ID, err)
 				}
+			})
+		} else if fromState == models.StatePublished {
+			// the same as MakePublish, the unpublished content can be published again without review
+			page.State = models.StateApproved
+			vals["state"] = page.State
+			if err := models.CreateReviewLog(db, page, models.WorkflowUnpublish, fromState, page.State, "", getRequestUser(ctx)); err != nil {
+				return err
 			}
-			return nil
-		},
+		}
+		event := models.EventUnpublish
+		if page.Published {
+			event = models.EventPublish
+		}
+		queueWebhook(ctx, models.GetEventName(models.ContentNamePage, event), page.SiteID, page)
+	}
+	if err := models.UpdateMediaReferences(db, page); err != nil {
+		return err
+	}
+	queueWebhook(ctx, models.GetEventName(models.ContentNamePage, models.EventUpdate), page.SiteID, map[string]any{"siteId": page.SiteID, "id": page.ID, "fields": getUpdateFields(vals)})
+	return nil
+}
+
+func (m *Manager) beforeDeletePage(db *gorm.DB, ctx *gin.Context, vptr any) error {
+	page := vptr.(*models.Page)
+	if err := checkPermission(db, ctx, page.SiteID, models.ContentNamePage, models.PermDelete); err != nil {
+		return err
+	}
+	if err := models.RemoveContentTags(db, models.ContentNamePage, page.SiteID, page.ID); err != nil {
+		return err
+	}
+	if err := models.RemoveSearchIndex(db, models.ContentNamePage, page.SiteID, page.ID); err != nil {
+		return err
+	}
+	if err := models.RemoveMediaReferences(db, models.ContentNamePage, page.SiteID, page.ID); err != nil {
+		return err
+	}
+	queueWebhook(ctx, models.GetEventName(models.ContentNamePage, models.EventDelete), page.SiteID, map[string]any{"siteId": page.SiteID, "id": page.ID})
+	return nil
+}
+
+func (m *Manager) beforeCreatePost(db *gorm.DB, ctx *gin.Context, vptr any) error {
+	post := vptr.(*models.Post)
+	if post.ContentType == "" {
+		post.ContentType = models.ContentTypeMarkdown
+	}
+	if err := checkSiteScope(ctx, post.SiteID); err != nil {
+		return err
+	}
+	if err := checkPermission(db, ctx, post.SiteID, models.ContentNamePost, models.PermCreate); err != nil {
+		return err
+	}
+	if user := getRequestUser(ctx); user != nil {
+		post.Creator = *user
+	}
+	post.IsDraft = true
+	post.Draft = models.SanitizeOnSave(db, post.ContentType, post.Draft)
+	if err := models.SyncContentTags(db, models.ContentNamePost, post.SiteID, post.ID, post.Tags); err != nil {
+		return err
+	}
+	if err := models.UpdateMediaReferences(db, post); err != nil {
+		return err
+	}
+	queueWebhook(ctx, models.GetEventName(models.ContentNamePost, models.EventCreate), post.SiteID, post)
+	return nil
+}
+
+func (m *Manager) beforeUpdatePost(db *gorm.DB, ctx *gin.Context, vptr any, vals map[string]any) error {
+	post := vptr.(*models.Post)
+	if err := checkPermission(db, ctx, post.SiteID, models.ContentNamePost, models.PermUpdate); err != nil {
+		return err
+	}
+	if siteId, ok := vals["site_id"].(string); ok {
+		if err := checkSiteScope(ctx, siteId); err != nil {
+			return err
+		}
+		if err := checkPermission(db, ctx, siteId, models.ContentNamePost, models.PermCreate); err != nil {
+			return err
+		}
+	}
+	post.IsDraft = true
+	if draft, ok := vals["draft"].(string); ok {
+		contentType := post.ContentType
+		if val, ok := vals["content_type"].(string); ok {
+			contentType = val
+		}
+		post.Draft = models.SanitizeOnSave(db, contentType, draft)
+		vals["draft"] = post.Draft
+		if post.GetState() != models.StateDraft && post.GetState() != models.StateArchived {
+			// the draft is changed, the review must start over
+			post.State = models.StateDraft
+			vals["state"] = post.State
+		}
+	}
+	if tags, ok := vals["tags"].(string); ok {
+		if err := models.SyncContentTags(db, models.ContentNamePost, post.SiteID, post.ID, tags); err != nil {
+			return err
+		}
+	}
+	if body, ok := vals["body"].(string); ok {
+		post.Body = body
+	}
+	if thumbnail, ok := vals["thumbnail"].(string); ok {
+		post.Thumbnail = thumbnail
+	}
+	// the form sends the current value on every save, only the change needs to publish
+	if published, ok := vals["published"].(bool); ok && published != post.Published {
+		if err := checkPermission(db, ctx, post.SiteID, models.ContentNamePost, models.PermPublish); err != nil {
+			return err
+		}
+		fromState := post.GetState()
+		if published {
+			if err := models.CheckCanPublish(db, post); err != nil {
+				return err
+			}
+		}
+		post.Published = published
+		if post.Published {
+			post.State = models.StatePublished
+			vals["state"] = post.State
+			if err := models.CreateReviewLog(db, post, models.WorkflowPublish, fromState, post.State, "", getRequestUser(ctx)); err != nil {
+				return err
+			}
+			post.Body = models.SanitizeOnSave(db, post.ContentType, post.Draft)
+			post.IsDraft = false
+			vals["body"] = post.Body
+			vals["is_draft"] = post.IsDraft
+			// the snapshot is taken from the written row, the other fields may change in the same update
+			siteID, ID, user := post.SiteID, post.ID, getRequestUser(ctx)
+			if val, ok := vals["site_id"].(string); ok {
+				siteID = val
+			}
+			afterWrite(ctx, func(db *gorm.DB) {
+				if err := models.CreatePublishLogFromDB(db, &models.Post{}, siteID, ID, user); err != nil {
+					carrot.Warning("create publish log failed:", siteID, ID, err)
+				}
+			})
+		} else if fromState == models.StatePublished {
+			// the same as MakePublish, the unpublished content can be published again without review
+			post.State = models.StateApproved
+			vals["state"] = post.State
+			if err := models.CreateReviewLog(db, post, models.WorkflowUnpublish, fromState, post.State, "", getRequestUser(ctx)); err != nil {
+				return err
+			}
+		}
+		event := models.EventUnpublish
+		if post.Published {
+			event = models.EventPublish
+		}
+		queueWebhook(ctx, models.GetEventName(models.ContentNamePost, event), post.SiteID, post)
+	}
+	if err := models.UpdateMediaReferences(db, post); err != nil {
+		return err
+	}
+	queueWebhook(ctx, models.GetEventName(models.ContentNamePost, models.EventUpdate), post.SiteID, map[string]any{"siteId": post.SiteID, "id": post.ID, "fields": getUpdateFields(vals)})
+	return nil
+}
+
+func (m *Manager) beforeDeletePost(db *gorm.DB, ctx *gin.Context, vptr any) error {
+	post := vptr.(*models.Post)
+	if err := checkPermission(db, ctx, post.SiteID, models.ContentNamePost, models.PermDelete); err != nil {
+		return err
+	}
+	if err := models.RemoveContentTags(db, models.ContentNamePost, post.SiteID, post.ID); err != nil {
+		return err
+	}
+	if err := models.RemoveSearchIndex(db, models.ContentNamePost, post.SiteID, post.ID); err != nil {
+		return err
 	}
+	if err := models.RemoveMediaReferences(db, models.ContentNamePost, post.SiteID, post.ID); err != nil {
+		return err
+	}
+	queueWebhook(ctx, models.GetEventName(models.ContentNamePost, models.EventDelete), post.SiteID, map[string]any{"siteId": post.SiteID, "id": post.ID})
+	return nil
 }
 
 func (m *Manager) handleMakePagePublish(db *gorm.DB, c *gin.Context, obj any, publish bool) (any, error) {
 	siteId := c.Query("site_id")
 	id := c.Query("id")
-	if err := models.MakePublish(db, siteId, id, obj, publish); err != nil {
+	if err := checkPermission(db, c, siteId, models.GetContentName(obj), models.PermPublish); err != nil {
+		return false, err
+	}
+	user := getRequestUser(c)
+	if err := models.MakePublish(db, siteId, id, obj, publish, user); err != nil {
 		carrot.Warning("make publish failed:", siteId, id, publish, err)
 		return false, err
 	}
@@ -226,6 +624,9 @@ func (m *Manager) handleMakePagePublish(db *gorm.DB, c *gin.Context, obj any, pu
 }
 
 func (m *Manager) handleMakePageDuplicate(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+	if err := checkPermission(db, c, c.Query("site_id"), models.GetContentName(obj), models.PermCreate); err != nil {
+		return false, err
+	}
 	if err := models.MakeDuplicate(db, obj); err != nil {
 		carrot.Warning("make duplicate failed:", obj, err)
 		return false, err
@@ -242,6 +643,10 @@ func (m *Manager) handleSaveDraft(db *gorm.DB, c *gin.Context, obj any) (any, er
 		return nil, err
 	}
 
+	if err := checkPermission(db, c, siteId, models.GetContentName(obj), models.PermUpdate); err != nil {
+		return false, err
+	}
+
 	draft, ok := formData["draft"]
 	if !ok {
 		return nil, models.ErrDraftIsInvalid
@@ -251,23 +656,71 @@ func (m *Manager) handleSaveDraft(db *gorm.DB, c *gin.Context, obj any) (any, er
 		carrot.Warning("safe draft failed:", siteId, id, err)
 		return false, err
 	}
+	event := models.GetEventName(models.GetContentName(obj), models.EventUpdate)
+	models.FireWebhook(db, event, siteId, map[string]any{"siteId": siteId, "id": id, "fields": []string{"draft"}})
+	return true, nil
+}
+
+func (m *Manager) handleListRevisions(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+	siteId := c.Query("site_id")
+	id := c.Query("id")
+	if err := checkPermission(db, c, siteId, models.GetContentName(obj), models.PermRead); err != nil {
+		return nil, err
+	}
+	return models.ListRevisions(db, models.GetContentName(obj), siteId, id)
+}
+
+func (m *Manager) handleDiffRevisions(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+	siteId := c.Query("site_id")
+	id := c.Query("id")
+	if err := checkPermission(db, c, siteId, models.GetContentName(obj), models.PermRead); err != nil {
+		return nil, err
+	}
+	from, err := strconv.ParseUint(c.Query("from"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	to, err := strconv.ParseUint(c.Query("to"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return models.DiffRevisions(db, models.GetContentName(obj), siteId, id, uint(from), uint(to))
+}
+
+func (m *Manager) handleRestoreRevision(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+	siteId := c.Query("site_id")
+	id := c.Query("id")
+	if err := checkPermission(db, c, siteId, models.GetContentName(obj), models.PermUpdate); err != nil {
+		return false, err
+	}
+	revisionId, err := strconv.ParseUint(c.Query("revision_id"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	if err := models.RestoreRevision(db, siteId, id, obj, uint(revisionId)); err != nil {
+		carrot.Warning("restore revision failed:", siteId, id, revisionId, err)
+		return false, err
+	}
 	return true, nil
 }
 
-func (m *Manager) handleQueryTags(db *gorm.DB, c *gin.Context, obj any, tableName string) (any, error) {
-	return models.QueryTags(db.Table(tableName))
+func (m *Manager) handleQueryTags(db *gorm.DB, c *gin.Context, obj any, content string) (any, error) {
+	return models.QueryTags(db, content)
 }
 
 func (m *Manager) beforeRenderPage(db *gorm.DB, ctx *gin.Context, vptr any) (any, error) {
 	draft, _ := strconv.ParseBool(ctx.Query("draft"))
 	result := vptr.(*models.Page)
-	if !draft && !result.Published {
+	if !draft && !result.IsLive(time.Now()) {
 		carrot.AbortWithJSONError(ctx, http.StatusTooEarly, models.ErrPageIsNotPublish)
 		return nil, models.ErrPageIsNotPublish
 	}
 	if draft {
 		result.Body = result.Draft
 	}
+	if carrot.GetBoolValue(m.db, models.KEY_CMS_SANITIZE_ON_RENDER) {
+		result.Body = models.GetHtmlPolicy(m.db).SanitizeBody(result.ContentType, result.Body)
+	}
 	return models.NewRenderContentFromPage(m.db, result), nil
 }
 
@@ -275,22 +728,28 @@ func (m *Manager) getPostOrPageDB(ctx *gin.Context, isCreate bool) *gorm.DB {
 	if isCreate {
 		return m.db
 	}
+	db := m.withSiteAccess(ctx, m.db, "site_id")
+	switch ctx.Request.Method {
+	case http.MethodPatch, http.MethodDelete:
+		// update and delete by api, the draft can be changed
+		return db
+	}
 	draft, _ := strconv.ParseBool(ctx.Query("draft"))
 	if draft {
-		return m.db
+		return db
 	}
 	// single get not need published
 	if ctx.Request.Method == http.MethodGet {
-		return m.db
+		return db
 	}
-	// query must be published
-	return m.db.Where("published", true)
+	// query must be published and within the schedule
+	return models.WithLiveContents(db, time.Now())
 }
 
 func (m *Manager) beforeRenderPost(db *gorm.DB, ctx *gin.Context, vptr any) (any, error) {
 	draft, _ := strconv.ParseBool(ctx.Query("draft"))
 	result := vptr.(*models.Post)
-	if !draft && !result.Published {
+	if !draft && !result.IsLive(time.Now()) {
 		return nil, models.ErrPostIsNotPublish
 	}
 	if draft {
@@ -302,7 +761,17 @@ func (m *Manager) beforeRenderPost(db *gorm.DB, ctx *gin.Context, vptr any) (any
 		relations = false
 	}
 
-	return models.NewRenderContentFromPost(m.db, result, relations), nil
+	r := models.NewRenderContentFromPost(m.db, result, relations)
+	if ctx.Query("render") == models.RenderModeHtml {
+		if err := r.RenderHtml(models.GetHtmlPolicy(m.db)); err != nil {
+			carrot.Warning("render html failed:", result.SiteID, result.ID, err)
+			return nil, err
+		}
+	}
+	if carrot.GetBoolValue(m.db, models.KEY_CMS_SANITIZE_ON_RENDER) {
+		r.PostBody = models.GetHtmlPolicy(m.db).SanitizeBody(r.ContentType, r.PostBody)
+	}
+	return r, nil
 }
 
 func (m *Manager) beforeQueryRenderPost(db *gorm.DB, ctx *gin.Context, queryResult *carrot.QueryResult) (any, error) {
@@ -334,3 +803,13 @@ func (m *Manager) beforeQueryRenderPost(db *gorm.DB, ctx *gin.Context, queryResu
 
 	return r, nil
 }
+
+// The changed fields of update, sorted by name
+func getUpdateFields(vals map[string]any) []string {
+	fields := make([]string, 0, len(vals))
+	for k := range vals {
+		fields = append(fields, k)
+	}
+	sort.Strings(fields)
+	return fields
+}
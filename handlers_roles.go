@@ -0,0 +1,26 @@
+package restcontent
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/restsend/restcontent/models"
+	"gorm.io/gorm"
+)
+
+// Check the request user has the permission on the content of site, see models.CheckPermission
+func checkPermission(db *gorm.DB, c *gin.Context, siteId, content, perm string) error {
+	return models.CheckPermission(db, getRequestUser(c), siteId, content, perm)
+}
+
+func (m *Manager) beforeCreateSite(db *gorm.DB, ctx *gin.Context, vptr any) error {
+	return checkPermission(db, ctx, "", models.ContentNameSite, models.PermManage)
+}
+
+func (m *Manager) beforeUpdateSite(db *gorm.DB, ctx *gin.Context, vptr any, vals map[string]any) error {
+	site := vptr.(*models.Site)
+	return checkPermission(db, ctx, site.Domain, models.ContentNameSite, models.PermManage)
+}
+
+func (m *Manager) beforeDeleteSite(db *gorm.DB, ctx *gin.Context, vptr any) error {
+	site := vptr.(*models.Site)
+	return checkPermission(db, ctx, site.Domain, models.ContentNameSite, models.PermManage)
+}
@@ -0,0 +1,84 @@
+package restcontent
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/restsend/carrot"
+	"github.com/restsend/restcontent/models"
+	"gorm.io/gorm"
+)
+
+// GET /search?site_id=&q=, query with type (post, page or both split by comma), category_id, pos and limit
+func (m *Manager) handleSearch(c *gin.Context) {
+	site, err := models.GetSite(m.db, c.Query("site_id"))
+	if err != nil {
+		carrot.AbortWithJSONError(c, http.StatusNotFound, err)
+		return
+	}
+	if !m.canAccessSite(c, site) {
+		carrot.AbortWithJSONError(c, http.StatusNotFound, models.ErrSiteIsDisallow)
+		return
+	}
+
+	form := models.SearchForm{
+		SiteID:     site.Domain,
+		Query:      strings.TrimSpace(c.Query("q")),
+		CategoryID: c.Query("category_id"),
+		Limit:      carrot.GetIntValue(m.db, models.KEY_CMS_SEARCH_SIZE, models.DefaultSearchSize),
+	}
+	if pos, err := strconv.Atoi(c.Query("pos")); err == nil {
+		form.Pos = pos
+	}
+	if limit, err := strconv.Atoi(c.Query("limit")); err == nil && limit > 0 {
+		form.Limit = limit
+	}
+
+	if types := c.Query("type"); types != "" {
+		for _, content := range strings.Split(types, ",") {
+			content = strings.TrimSpace(content)
+			if content != models.ContentNamePost && content != models.ContentNamePage {
+				carrot.AbortWithJSONError(c, http.StatusBadRequest, models.ErrInvalidContentType)
+				return
+			}
+			if !checkApiScope(c, "read:"+content) {
+				return
+			}
+			form.Contents = append(form.Contents, content)
+		}
+	} else {
+		// search the contents the api token can read
+		for _, content := range []string{models.ContentNamePost, models.ContentNamePage} {
+			if token := getApiToken(c); token == nil || token.HasScope("read:"+content) {
+				form.Contents = append(form.Contents, content)
+			}
+		}
+		if len(form.Contents) == 0 {
+			carrot.AbortWithJSONError(c, http.StatusForbidden, models.ErrApiScopeDenied)
+			return
+		}
+	}
+
+	r, err := models.SearchContents(m.db, &form, time.Now())
+	if err != nil {
+		if err == models.ErrEmptySearchQuery {
+			carrot.AbortWithJSONError(c, http.StatusBadRequest, err)
+			return
+		}
+		carrot.AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+func (m *Manager) handleRebuildSearchIndex(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+	count, err := models.RebuildSearchIndex(db)
+	if err != nil {
+		carrot.Warning("rebuild search index failed:", err)
+		return false, err
+	}
+	return count, nil
+}
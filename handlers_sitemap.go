@@ -0,0 +1,102 @@
+package restcontent
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/restsend/carrot"
+	"github.com/restsend/restcontent/models"
+)
+
+func renderXML(c *gin.Context, contentType string, v any) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		carrot.AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.Data(http.StatusOK, contentType, append([]byte(xml.Header), data...))
+}
+
+// The absolute url of the current request's directory, eg: https://api.example.com/api/sitemap/
+func (m *Manager) getRequestBaseUrl(c *gin.Context, name string) string {
+	apiHost := strings.TrimSuffix(carrot.GetValue(m.db, models.KEY_CMS_API_HOST), "/")
+	if apiHost == "" {
+		scheme := "http"
+		if c.Request.TLS != nil {
+			scheme = "https"
+		}
+		apiHost = scheme + "://" + c.Request.Host
+	}
+	return apiHost + strings.TrimSuffix(c.Request.URL.Path, name)
+}
+
+// GET /sitemap/{site}.xml or /sitemap/{site}-{n}.xml
+func (m *Manager) handleSitemap(c *gin.Context) {
+	name := c.Param("name")
+	siteId := strings.TrimSuffix(name, ".xml")
+
+	pageNo := 0
+	site, err := models.GetSite(m.db, siteId)
+	if err != nil {
+		if idx := strings.LastIndex(siteId, "-"); idx > 0 {
+			if n, convErr := strconv.Atoi(siteId[idx+1:]); convErr == nil && n > 0 {
+				pageNo = n
+				site, err = models.GetSite(m.db, siteId[:idx])
+			}
+		}
+	}
+	if err != nil {
+		carrot.AbortWithJSONError(c, http.StatusNotFound, err)
+		return
+	}
+	if !checkApiScope(c, models.ApiScopeReadPage) || !checkApiScope(c, models.ApiScopeReadPost) {
+		return
+	}
+	if site.Disallow || !m.canAccessSite(c, site) {
+		carrot.AbortWithJSONError(c, http.StatusNotFound, models.ErrSiteIsDisallow)
+		return
+	}
+
+	size := carrot.GetIntValue(m.db, models.KEY_CMS_SITEMAP_SIZE, models.DefaultSitemapSize)
+	if size <= 0 {
+		size = models.DefaultSitemapSize
+	}
+	total, lastMod, err := models.CountSitemapUrls(m.db, site.Domain)
+	if err != nil {
+		carrot.AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	if pageNo == 0 && total > int64(size) {
+		// sitemap index for large site
+		baseUrl := m.getRequestBaseUrl(c, name)
+		index := models.SitemapIndex{Xmlns: models.SitemapXmlns}
+		for i := 1; int64(i-1)*int64(size) < total; i++ {
+			index.Sitemaps = append(index.Sitemaps, models.SitemapUrl{
+				Loc:     fmt.Sprintf("%s%s-%d.xml", baseUrl, site.Domain, i),
+				LastMod: models.FormatLastMod(lastMod),
+			})
+		}
+		renderXML(c, "application/xml; charset=utf-8", &index)
+		return
+	}
+
+	pos := 0
+	if pageNo > 0 {
+		pos = (pageNo - 1) * size
+		if int64(pos) >= total {
+			carrot.AbortWithJSONError(c, http.StatusNotFound, models.ErrSitemapNotFound)
+			return
+		}
+	}
+	r, err := models.BuildSitemap(m.db, site, pos, size)
+	if err != nil {
+		carrot.AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+	renderXML(c, "application/xml; charset=utf-8", r)
+}
@@ -2,24 +2,206 @@ package restcontent
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/restsend/carrot"
 	"github.com/restsend/restcontent/models"
+	"gorm.io/gorm"
 )
 
+func (m *Manager) getTagObject() carrot.AdminObject {
+	return carrot.AdminObject{
+		Model:       &models.Tag{},
+		Group:       "Contents",
+		Name:        "Tag",
+		Desc:        "Tags of posts, pages and media, rename or merge tags will update all related contents",
+		Shows:       []string{"Name", "Slug", "SiteID", "Color", "Count", "UpdatedAt"},
+		Editables:   []string{"SiteID", "Name", "Slug", "Description", "Color"},
+		Filterables: []string{"SiteID", "UpdatedAt"},
+		Orderables:  []string{"UpdatedAt"},
+		Searchables: []string{"Name", "Slug", "Description"},
+		Requireds:   []string{"Name"},
+		Icon:        readIcon("./icon/tag.svg"),
+		Attributes: map[string]carrot.AdminAttribute{
+			"Slug": {Help: "Slug is generated from name if empty, eg: Hello World => hello-world, use Merge into to join an exists tag"},
+		},
+		Orders: []carrot.Order{
+			{
+				Name: "UpdatedAt",
+				Op:   carrot.OrderOpDesc,
+			},
+		},
+		BeforeRender: func(db *gorm.DB, ctx *gin.Context, vptr any) (any, error) {
+			tag := vptr.(*models.Tag)
+			tag.Count = models.CountTagContents(db, tag.ID)
+			return vptr, nil
+		},
+		BeforeCreate: func(db *gorm.DB, ctx *gin.Context, vptr any) error {
+			tag := vptr.(*models.Tag)
+			if err := checkTagPermission(db, ctx, tag.SiteID); err != nil {
+				return err
+			}
+			if tag.Slug == "" {
+				tag.Slug = models.MakeTagSlug(tag.Name)
+			}
+			if tag.Slug == "" {
+				return models.ErrInvalidTag
+			}
+			return nil
+		},
+		BeforeUpdate: func(db *gorm.DB, ctx *gin.Context, vptr any, vals map[string]any) error {
+			// the name and slug are changed with the contents here, merging into another tag is the merge action
+			tag := vptr.(*models.Tag)
+			if err := checkTagPermission(db, ctx, tag.SiteID); err != nil {
+				return err
+			}
+			if siteId, ok := vals["site_id"].(string); ok && siteId != tag.SiteID {
+				if err := checkTagPermission(db, ctx, siteId); err != nil {
+					return err
+				}
+			}
+			name, _ := vals["name"].(string)
+			slug, hasSlug := vals["slug"].(string)
+			if (name != "" && name != tag.Name) || (hasSlug && slug != tag.Slug) {
+				if _, err := models.UpdateTagName(db, tag.ID, name, slug); err != nil {
+					return err
+				}
+			}
+			delete(vals, "name")
+			delete(vals, "slug")
+			return nil
+		},
+		BeforeDelete: func(db *gorm.DB, ctx *gin.Context, vptr any) error {
+			tag := vptr.(*models.Tag)
+			if err := checkTagPermission(db, ctx, tag.SiteID); err != nil {
+				return err
+			}
+			return models.RemoveTag(db, tag)
+		},
+		Actions: []carrot.AdminAction{
+			{
+				Path:    "rename",
+				Name:    "Rename",
+				Handler: m.handleRenameTag,
+			},
+			{
+				Path:    "merge",
+				Name:    "Merge into",
+				Handler: m.handleMergeTags,
+			},
+			{
+				WithoutObject: true,
+				Path:          "rebuild",
+				Name:          "Rebuild from contents",
+				Handler:       m.handleRebuildTags,
+			},
+		},
+	}
+}
+
+// Tags are shared by all contents of site, rename, merge or remove a tag changes the contents of others,
+// so the editor role is required, which is the lowest role can delete
+func checkTagPermission(db *gorm.DB, c *gin.Context, siteId string) error {
+	if err := checkSiteScope(c, siteId); err != nil {
+		return err
+	}
+	return checkPermission(db, c, siteId, models.ContentNameTag, models.PermDelete)
+}
+
+func checkTagPermissionByID(db *gorm.DB, c *gin.Context, id uint64) error {
+	var tag models.Tag
+	if err := db.Select("id", "site_id").First(&tag, id).Error; err != nil {
+		return err
+	}
+	return checkTagPermission(db, c, tag.SiteID)
+}
+
+func (m *Manager) handleRenameTag(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+	id, err := strconv.ParseUint(c.Query("id"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTagPermissionByID(db, c, id); err != nil {
+		return nil, err
+	}
+	return models.RenameTag(db, uint(id), c.Query("name"))
+}
+
+func (m *Manager) handleMergeTags(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+	id, err := strconv.ParseUint(c.Query("id"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	to, err := strconv.ParseUint(c.Query("to"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	// the tags of different sites can't be merged, checking the source is enough
+	if err := checkTagPermissionByID(db, c, id); err != nil {
+		return nil, err
+	}
+	if err := models.MergeTags(db, uint(id), uint(to)); err != nil {
+		carrot.Warning("merge tags failed:", id, to, err)
+		return false, err
+	}
+	return true, nil
+}
+
+// Rebuild scans the contents of all sites, only superuser can do it
+func (m *Manager) handleRebuildTags(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+	if user := carrot.CurrentUser(c); user == nil || !user.IsSuperUser {
+		return nil, models.ErrPermissionDenied
+	}
+	if err := models.MigrateLegacyTags(db); err != nil {
+		carrot.Warning("rebuild tags failed:", err)
+		return false, err
+	}
+	return true, nil
+}
+
 func (m *Manager) handleGetTags(c *gin.Context) {
 	contentType := c.Param("content_type")
+	if contentType != models.ContentNamePost && contentType != models.ContentNamePage {
+		carrot.AbortWithJSONError(c, http.StatusBadRequest, models.ErrInvalidContentType)
+		return
+	}
+	if !checkApiScope(c, "read:"+contentType) {
+		return
+	}
 	var form models.TagsForm
 	if err := c.BindJSON(&form); err != nil {
 		carrot.AbortWithJSONError(c, http.StatusBadRequest, err)
 		return
 	}
 
-	tags, err := models.GetTagsByCategory(m.db, contentType, &form)
+	tags, err := models.GetTagsByCategory(m.db, contentType, &form, m.siteAccessScope(c, contentType+"s.site_id"))
 	if err != nil {
 		carrot.AbortWithJSONError(c, http.StatusInternalServerError, err)
 		return
 	}
 	c.JSON(http.StatusOK, tags)
 }
+
+func (m *Manager) handleQueryByTags(c *gin.Context) {
+	contentType := c.Param("content_type")
+	if contentType != models.ContentNamePost && contentType != models.ContentNamePage {
+		carrot.AbortWithJSONError(c, http.StatusBadRequest, models.ErrInvalidContentType)
+		return
+	}
+	if !checkApiScope(c, "read:"+contentType) {
+		return
+	}
+	var form models.QueryByTagsForm
+	if err := c.BindJSON(&form); err != nil {
+		carrot.AbortWithJSONError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	r, err := models.QueryContentByTags(m.db, contentType, &form, m.siteAccessScope(c, contentType+"s.site_id"))
+	if err != nil {
+		carrot.AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
@@ -0,0 +1,89 @@
+package restcontent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/restsend/carrot"
+	"github.com/restsend/restcontent/models"
+)
+
+func newTestManager(t *testing.T) *Manager {
+	gin.SetMode(gin.TestMode)
+	db, err := carrot.InitDatabase(nil, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Migration(db); err != nil {
+		t.Fatal(err)
+	}
+	return NewManager(db)
+}
+
+func TestHandleMediaSiteAccess(t *testing.T) {
+	m := newTestManager(t)
+	carrot.SetValue(m.db, models.KEY_CMS_GUEST_ACCESS_API, "true")
+	carrot.SetValue(m.db, models.KEY_CMS_MEDIA_SIGN_SECRET, "test-secret")
+
+	sites := []models.Site{
+		{Domain: "a.com", Name: "A", ApiKey: "site-a-key"},
+		{Domain: "b.com", Name: "B", Disallow: true},
+	}
+	if err := m.db.Create(&sites).Error; err != nil {
+		t.Fatal(err)
+	}
+	medias := map[string]*models.Media{}
+	for _, siteID := range []string{"", "a.com", "b.com"} {
+		media := &models.Media{SiteID: siteID, Path: "/", Name: "logo.png", External: true, StorePath: "https://cdn.example.com/logo.png"}
+		media.Published = true
+		if err := m.db.Create(media).Error; err != nil {
+			t.Fatal(err)
+		}
+		medias[siteID] = media
+	}
+	token := models.ApiToken{Name: "a", Scopes: models.ApiScopeReadAll, SiteID: "a.com", Enabled: true}
+	token.GenerateToken()
+	if err := m.db.Create(&token).Error; err != nil {
+		t.Fatal(err)
+	}
+	signed, err := models.SignMediaQuery(m.db, medias["b.com"], time.Now().Add(time.Hour), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.Group("/media", m.MediaAuthRequired, m.apiScopeRequired(models.ContentNameMedia)).GET("/*filepath", m.handleMedia)
+
+	tests := []struct {
+		name   string
+		url    string
+		auth   string
+		status int
+	}{
+		{"guest reads shared library", "/media/logo.png", "", http.StatusFound},
+		{"guest reads allowed site", "/media/@a.com/logo.png", "", http.StatusFound},
+		{"guest reads disallowed site", "/media/@b.com/logo.png", "", http.StatusNotFound},
+		{"signed url of disallowed site", "/media/@b.com/logo.png?" + signed.Encode(), "", http.StatusNotFound},
+		{"site key reads its site", "/media/@a.com/logo.png", "site-a-key", http.StatusFound},
+		{"site key reads shared library", "/media/logo.png", "site-a-key", http.StatusFound},
+		{"site key reads other site", "/media/@b.com/logo.png", "site-a-key", http.StatusNotFound},
+		{"api token reads its site", "/media/@a.com/logo.png", token.Token, http.StatusFound},
+		{"api token reads other site", "/media/@b.com/logo.png", token.Token, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.auth)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d, body: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+}
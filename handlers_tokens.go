@@ -0,0 +1,163 @@
+package restcontent
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/restsend/carrot"
+	"github.com/restsend/restcontent/models"
+	"gorm.io/gorm"
+)
+
+// The api token of request
+const ApiTokenField = "_restcontent_api_token"
+
+func (m *Manager) getApiTokenObject() carrot.AdminObject {
+	return carrot.AdminObject{
+		Model:       &models.ApiToken{},
+		Group:       "Settings",
+		Name:        "ApiToken",
+		Desc:        "Tokens for the public api, the token is only shown once when it's created or regenerated",
+		Shows:       []string{"Name", "Prefix", "User", "Scopes", "SiteID", "Enabled", "ExpiredAt", "LastUsedAt", "CreatedAt"},
+		Editables:   []string{"Name", "User", "Scopes", "SiteID", "Enabled", "ExpiredAt"},
+		Filterables: []string{"SiteID", "Enabled", "CreatedAt"},
+		Orderables:  []string{"CreatedAt", "LastUsedAt"},
+		Searchables: []string{"Name", "Prefix"},
+		Requireds:   []string{"Name", "Scopes"},
+		Icon:        readIcon("./icon/key.svg"),
+		Attributes: map[string]carrot.AdminAttribute{
+			"Scopes":    {Widget: "tags", Choices: models.ApiScopes, Help: "write includes read"},
+			"SiteID":    {Help: "Only the contents of the site can be accessed, empty is all sites"},
+			"User":      {SingleChoice: true, Help: "The owner of token, default is current user, the roles of owner are applied, the token without owner is read only"},
+			"Enabled":   {Default: true},
+			"ExpiredAt": {Help: "Never expire if empty"},
+		},
+		Orders: []carrot.Order{
+			{
+				Name: "CreatedAt",
+				Op:   carrot.OrderOpDesc,
+			},
+		},
+		Scripts: []carrot.AdminScript{
+			{Src: "./js/cms_widget.js"},
+		},
+		Actions: []carrot.AdminAction{
+			{
+				Path:    "regenerate",
+				Name:    "Regenerate",
+				Handler: m.handleRegenerateApiToken,
+			},
+			{
+				Path:    "revoke",
+				Name:    "Revoke",
+				Handler: m.handleRevokeApiToken,
+			},
+		},
+		BeforeCreate: func(db *gorm.DB, ctx *gin.Context, vptr any) error {
+			token := vptr.(*models.ApiToken)
+			if token.UserID == 0 {
+				if user := carrot.CurrentUser(ctx); user != nil {
+					token.UserID = user.ID
+				}
+			}
+			if err := models.CheckApiScopes(token.Scopes); err != nil {
+				return err
+			}
+			token.GenerateToken()
+			return nil
+		},
+		BeforeUpdate: func(db *gorm.DB, ctx *gin.Context, vptr any, vals map[string]any) error {
+			if scopes, ok := vals["scopes"].(string); ok {
+				return models.CheckApiScopes(scopes)
+			}
+			return nil
+		},
+	}
+}
+
+func (m *Manager) handleRegenerateApiToken(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+	id, err := strconv.ParseUint(c.Query("id"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return models.RegenerateApiToken(db, uint(id))
+}
+
+func (m *Manager) handleRevokeApiToken(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+	id, err := strconv.ParseUint(c.Query("id"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return true, models.RevokeApiToken(db, uint(id))
+}
+
+func getApiToken(c *gin.Context) *models.ApiToken {
+	if val, ok := c.Get(ApiTokenField); ok {
+		return val.(*models.ApiToken)
+	}
+	return nil
+}
+
+// The user of request, the owner of api token is used if the request is authorized by api token
+func getRequestUser(c *gin.Context) *carrot.User {
+	if user := carrot.CurrentUser(c); user != nil {
+		return user
+	}
+	if token := getApiToken(c); token != nil && token.UserID != 0 {
+		return &token.User
+	}
+	return nil
+}
+
+// The scope of request, the query and get are read, others are write
+func getRequestScope(c *gin.Context, content string) string {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return "read:" + content
+	case http.MethodPost:
+		if strings.HasSuffix(c.Request.URL.Path, "/query") {
+			return "read:" + content
+		}
+	}
+	return "write:" + content
+}
+
+// Check the scope of api token, the write without api token must be a staff user
+func checkApiScope(c *gin.Context, scope string) bool {
+	if token := getApiToken(c); token != nil {
+		if token.HasScope(scope) {
+			return true
+		}
+		carrot.AbortWithJSONError(c, http.StatusForbidden, models.ErrApiScopeDenied)
+		return false
+	}
+	if strings.HasPrefix(scope, "write:") {
+		if user := carrot.CurrentUser(c); user == nil || !user.IsStaff {
+			carrot.AbortWithJSONError(c, http.StatusForbidden, models.ErrUnauthorized)
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Manager) apiScopeRequired(content string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !checkApiScope(c, getRequestScope(c, content)) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// Site and category are readable by all api tokens, only the write is checked
+func (m *Manager) apiWriteRequired(content string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scope := getRequestScope(c, content)
+		if strings.HasPrefix(scope, "write:") && !checkApiScope(c, scope) {
+			return
+		}
+		c.Next()
+	}
+}
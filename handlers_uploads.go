@@ -0,0 +1,96 @@
+package restcontent
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/restsend/restcontent/models"
+	"gorm.io/gorm"
+)
+
+// The resumable upload, the client creates a session with total size, sends the chunks with offset,
+// queries the offset to resume after the connection is broken, and finishes to create the media:
+//
+//	POST upload_create?site_id=&path=&name=&size=
+//	POST upload_chunk?id=&offset= with the raw chunk as body, the offset also can be the Upload-Offset header
+//	POST upload_status?id=
+//	POST upload_finish?id=&created=
+func (m *Manager) handleUploadCreate(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+	siteId := c.Query("site_id")
+	if err := checkMediaPermission(db, c, siteId, models.PermCreate); err != nil {
+		return nil, err
+	}
+	size, err := strconv.ParseInt(c.Query("size"), 10, 64)
+	if err != nil {
+		return nil, models.ErrInvalidUploadSize
+	}
+	return models.CreateUploadSession(db, siteId, c.Query("path"), c.Query("name"), size, getRequestUser(c))
+}
+
+func (m *Manager) getUploadSession(db *gorm.DB, c *gin.Context) (*models.UploadSession, error) {
+	s, err := models.GetUploadSession(db, c.Query("id"), getRequestUser(c))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMediaPermission(db, c, s.SiteID, models.PermCreate); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (m *Manager) handleUploadChunk(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+	s, err := m.getUploadSession(db, c)
+	if err != nil {
+		return nil, err
+	}
+	val := c.Query("offset")
+	if val == "" {
+		val = c.GetHeader("Upload-Offset")
+	}
+	offset, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return nil, models.ErrUploadOffsetMismatch
+	}
+	err = models.WriteUploadChunk(db, s, offset, c.Request.Body)
+	c.Header("Upload-Offset", strconv.FormatInt(s.Offset, 10))
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (m *Manager) handleUploadStatus(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+	s, err := m.getUploadSession(db, c)
+	if err != nil {
+		return nil, err
+	}
+	c.Header("Upload-Offset", strconv.FormatInt(s.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(s.Size, 10))
+	return s, nil
+}
+
+func (m *Manager) handleUploadFinish(db *gorm.DB, c *gin.Context, created bool) (any, error) {
+	s, err := m.getUploadSession(db, c)
+	if err != nil {
+		return nil, err
+	}
+	// the chunk being written and the other finish of the same session wait until the media is created
+	unlock := models.LockUploadSession(s.ID)
+	defer unlock()
+
+	f, err := models.OpenUploadSession(db, s)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := m.createUploadedMedia(db, c, s.SiteID, s.Path, s.Name, f, created)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	if err := models.RemoveUploadSession(db, s); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
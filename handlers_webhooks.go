@@ -0,0 +1,146 @@
+package restcontent
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/restsend/carrot"
+	"github.com/restsend/restcontent/models"
+	"gorm.io/gorm"
+)
+
+func (m *Manager) getWebhookObjects() []carrot.AdminObject {
+	return []carrot.AdminObject{
+		{
+			Model:       &models.Webhook{},
+			Group:       "Settings",
+			Name:        "Webhook",
+			Desc:        "Notify the downstream systems when contents are changed, the payload is signed with the secret",
+			Shows:       []string{"Name", "Url", "Events", "SiteID", "Enabled", "UpdatedAt"},
+			Editables:   []string{"Name", "Url", "Secret", "Events", "SiteID", "Enabled"},
+			Filterables: []string{"SiteID", "Enabled"},
+			Orderables:  []string{"UpdatedAt"},
+			Searchables: []string{"Name", "Url"},
+			Requireds:   []string{"Name", "Url"},
+			Icon:        readIcon("./icon/bolt.svg"),
+			Attributes: map[string]carrot.AdminAttribute{
+				"Events":  {Widget: "tags", Help: "eg: post.publish, page.*, media.upload, empty is all events"},
+				"Secret":  {Help: "X-RestContent-Signature is sha256=HMAC-SHA256(secret, timestamp + '.' + body), leave empty to keep the current one"},
+				"SiteID":  {Help: "Only the events of the site, empty is all sites"},
+				"Enabled": {Default: true},
+			},
+			Orders: []carrot.Order{
+				{
+					Name: "UpdatedAt",
+					Op:   carrot.OrderOpDesc,
+				},
+			},
+			Scripts: []carrot.AdminScript{
+				{Src: "./js/cms_widget.js"},
+			},
+			Actions: []carrot.AdminAction{
+				{
+					Path:    "ping",
+					Name:    "Ping",
+					Handler: m.handlePingWebhook,
+				},
+				{
+					Path:    "rotate_secret",
+					Name:    "Rotate Secret",
+					Handler: m.handleRotateWebhookSecret,
+				},
+			},
+			BeforeRender: func(db *gorm.DB, ctx *gin.Context, vptr any) (any, error) {
+				vptr.(*models.Webhook).Secret = ""
+				return vptr, nil
+			},
+			BeforeCreate: func(db *gorm.DB, ctx *gin.Context, vptr any) error {
+				webhook := vptr.(*models.Webhook)
+				if webhook.Secret == "" {
+					webhook.Secret = carrot.RandText(models.SiteApiKeySize)
+				}
+				return models.CheckWebhookUrl(webhook.Url)
+			},
+			BeforeUpdate: func(db *gorm.DB, ctx *gin.Context, vptr any, vals map[string]any) error {
+				if secret, ok := vals["secret"].(string); ok && secret == "" {
+					// the secret is never rendered, the empty one in form is not changed
+					delete(vals, "secret")
+				}
+				if url, ok := vals["url"].(string); ok {
+					return models.CheckWebhookUrl(url)
+				}
+				return nil
+			},
+			BeforeDelete: func(db *gorm.DB, ctx *gin.Context, vptr any) error {
+				webhook := vptr.(*models.Webhook)
+				return db.Where("webhook_id", webhook.ID).Delete(&models.WebhookDelivery{}).Error
+			},
+		},
+		{
+			Model:       &models.WebhookDelivery{},
+			Group:       "Settings",
+			Name:        "WebhookDelivery",
+			Desc:        "The delivery log of webhooks, failed deliveries are retried with backoff",
+			Shows:       []string{"ID", "Webhook", "Event", "SiteID", "Status", "Attempts", "StatusCode", "NextRetryAt", "CreatedAt"},
+			Editables:   []string{},
+			Filterables: []string{"Event", "Status", "CreatedAt"},
+			Orderables:  []string{"CreatedAt"},
+			Searchables: []string{"Event", "SiteID", "Error"},
+			Invisible:   true,
+			Orders: []carrot.Order{
+				{
+					Name: "CreatedAt",
+					Op:   carrot.OrderOpDesc,
+				},
+			},
+			Actions: []carrot.AdminAction{
+				{
+					Path:    "redeliver",
+					Name:    "Redeliver",
+					Handler: m.handleRedeliverWebhook,
+				},
+			},
+			BeforeRender: func(db *gorm.DB, ctx *gin.Context, vptr any) (any, error) {
+				vptr.(*models.WebhookDelivery).Webhook.Secret = ""
+				return vptr, nil
+			},
+		},
+	}
+}
+
+func (m *Manager) handlePingWebhook(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+	id, err := strconv.ParseUint(c.Query("id"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return models.PingWebhook(db, uint(id))
+}
+
+// Generate a new secret, the secret is returned only once here,
+// the admin also can set the secret in the edit form
+func (m *Manager) handleRotateWebhookSecret(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+	id, err := strconv.ParseUint(c.Query("id"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := models.RotateWebhookSecret(db, uint(id))
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"secret": secret}, nil
+}
+
+func (m *Manager) handleRedeliverWebhook(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+	id, err := strconv.ParseUint(c.Query("id"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return true, models.RedeliverWebhook(db, uint(id))
+}
+
+// The events of Before* hooks are fired after the handler succeeds, the row is not written in the hooks
+func queueWebhook(c *gin.Context, event, siteID string, data any) {
+	afterWrite(c, func(db *gorm.DB) {
+		models.FireWebhook(db, event, siteID, data)
+	})
+}
@@ -0,0 +1,47 @@
+package restcontent
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/restsend/restcontent/models"
+	"gorm.io/gorm"
+)
+
+// Submit, approve, reject, archive or restore the content, reject with comment
+func (m *Manager) handleWorkflow(db *gorm.DB, c *gin.Context, obj any, action string) (any, error) {
+	siteId := c.Query("site_id")
+	id := c.Query("id")
+
+	perm := models.PermPublish
+	if action == models.WorkflowSubmit {
+		perm = models.PermUpdate
+	}
+	if err := checkPermission(db, c, siteId, models.GetContentName(obj), perm); err != nil {
+		return nil, err
+	}
+	if err := db.Where("site_id", siteId).Where("id", id).Take(obj).Error; err != nil {
+		return nil, err
+	}
+
+	var form struct {
+		Comment string `json:"comment"`
+	}
+	c.ShouldBind(&form)
+	if form.Comment == "" {
+		form.Comment = c.Query("comment")
+	}
+	return models.MakeTransition(db, obj, action, form.Comment, getRequestUser(c))
+}
+
+func (m *Manager) handleListReviewLogs(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+	siteId := c.Query("site_id")
+	id := c.Query("id")
+	if err := checkPermission(db, c, siteId, models.GetContentName(obj), models.PermRead); err != nil {
+		return nil, err
+	}
+	return models.ListReviewLogs(db, models.GetContentName(obj), siteId, id)
+}
+
+// The contents in review of the sites which the user can publish
+func (m *Manager) handleReviewQueue(db *gorm.DB, c *gin.Context, obj any, content string) (any, error) {
+	return models.ListReviewQueue(db, content, c.Query("site_id"), getRequestUser(c), models.MaxQueryLimit)
+}
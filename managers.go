@@ -28,14 +28,50 @@ func NewManager(db *gorm.DB) *Manager {
 }
 
 func Migration(db *gorm.DB) error {
-	return carrot.MakeMigrates(db, []any{
+	hasTagTable := db.Migrator().HasTable(&models.Tag{})
+	hasSchedule := !db.Migrator().HasTable(&models.Post{}) || db.Migrator().HasColumn(&models.Post{}, "scheduled_at")
+	// before the column is altered to not null
+	if err := models.MigrateMediaSiteID(db); err != nil {
+		return err
+	}
+	// before the column is altered to text
+	if err := models.MigrateTagsColumn(db); err != nil {
+		return err
+	}
+	err := carrot.MakeMigrates(db, []any{
 		&models.Site{},
 		&models.Page{},
 		&models.Post{},
 		&models.Media{},
 		&models.PublishLog{},
 		&models.Category{},
+		&models.Tag{},
+		&models.ContentTag{},
+		&models.ApiToken{},
+		&models.ReviewLog{},
+		&models.Webhook{},
+		&models.WebhookDelivery{},
+		&models.SearchDocument{},
+		&models.SearchTerm{},
+		&models.UploadSession{},
+		&models.MediaReference{},
 	})
+	if err != nil {
+		return err
+	}
+	if err := models.MigrateMediaSiteIndex(db); err != nil {
+		return err
+	}
+	if !hasSchedule {
+		if err := models.MigrateContentSchedule(db, time.Now()); err != nil {
+			return err
+		}
+	}
+	if !hasTagTable {
+		// migrate from the legacy tags string
+		return models.MigrateLegacyTags(db)
+	}
+	return nil
 }
 
 func (m *Manager) Prepare(engine *gin.Engine, lw io.Writer) error {
@@ -54,12 +90,39 @@ func (m *Manager) Prepare(engine *gin.Engine, lw io.Writer) error {
 	carrot.CheckValue(m.db, models.KEY_CMS_API_HOST, "")
 	carrot.CheckValue(m.db, models.KEY_CMS_RELATION_COUNT, "3")
 	carrot.CheckValue(m.db, models.KEY_CMS_SUGGESTION_COUNT, "3")
+	carrot.CheckValue(m.db, models.KEY_CMS_SCHEDULE_INTERVAL, "60")
+	carrot.CheckValue(m.db, models.KEY_CMS_HTML_POLICY, models.DefaultHtmlPolicyValue())
+	carrot.CheckValue(m.db, models.KEY_CMS_SANITIZE_ON_SAVE, "true")
+	carrot.CheckValue(m.db, models.KEY_CMS_SANITIZE_ON_RENDER, "false")
+	carrot.CheckValue(m.db, models.KEY_CMS_SITEMAP_SIZE, "50000")
+	carrot.CheckValue(m.db, models.KEY_CMS_FEED_SIZE, "20")
+	carrot.CheckValue(m.db, models.KEY_CMS_FEED_FULL_CONTENT, "false")
+	carrot.CheckValue(m.db, models.KEY_CMS_WEBHOOK_MAX_ATTEMPTS, "5")
+	carrot.CheckValue(m.db, models.KEY_CMS_WEBHOOK_TIMEOUT, "10")
+	carrot.CheckValue(m.db, models.KEY_CMS_SEARCH_SIZE, "10")
+	carrot.CheckValue(m.db, models.KEY_CMS_STORAGE, models.StorageLocal)
+	carrot.CheckValue(m.db, models.KEY_CMS_S3_ENDPOINT, "")
+	carrot.CheckValue(m.db, models.KEY_CMS_S3_REGION, "us-east-1")
+	carrot.CheckValue(m.db, models.KEY_CMS_S3_BUCKET, "")
+	carrot.CheckValue(m.db, models.KEY_CMS_S3_ACCESS_KEY, "")
+	carrot.CheckValue(m.db, models.KEY_CMS_S3_SECRET_KEY, "")
+	carrot.CheckValue(m.db, models.KEY_CMS_S3_PATH_STYLE, "false")
+	carrot.CheckValue(m.db, models.KEY_CMS_S3_PUBLIC_URL, "")
+	carrot.CheckValue(m.db, models.KEY_CMS_IMAGE_VARIANTS, models.DefaultImageVariants)
+	carrot.CheckValue(m.db, models.KEY_CMS_IMAGE_TRANSFORM_SIZES, models.DefaultImageTransformSizes)
+	carrot.CheckValue(m.db, models.KEY_CMS_IMAGE_CACHE_DIR, "./data/cache/images/")
+	carrot.CheckValue(m.db, models.KEY_CMS_UPLOAD_CHUNK_DIR, "./data/chunks/")
+	carrot.CheckValue(m.db, models.KEY_CMS_UPLOAD_SESSION_EXPIRES, "24")
+	carrot.CheckValue(m.db, models.KEY_CMS_MEDIA_SIGN_SECRET, carrot.RandText(32))
+	carrot.CheckValue(m.db, models.KEY_CMS_MEDIA_SIGNED_EXPIRES, "3600")
 
 	if err := carrot.InitCarrot(m.db, engine); err != nil {
 		return err
 	}
 
 	m.RegisterHandlers(engine)
+	m.StartScheduler()
+	m.StartWebhookWorker()
 	return nil
 }
 
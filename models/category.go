@@ -4,7 +4,7 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"fmt"
-	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -24,6 +24,8 @@ type Category struct {
 	Name   string        `json:"name" gorm:"size:200"`
 	Items  CategoryItems `json:"items,omitempty"`
 	Count  int           `json:"count" gorm:"-"`
+	// the contents must be approved before publish
+	ReviewRequired bool `json:"reviewRequired,omitempty"`
 }
 
 type RenderCategory struct {
@@ -119,16 +121,60 @@ func NewRenderCategory(db *gorm.DB, categoryID, categoryPath string) *RenderCate
 	return obj
 }
 
-// Query tags by category
-func GetTagsByCategory(db *gorm.DB, contentType string, form *TagsForm) ([]string, error) {
+// Query tags by category, the scope limits the contents, eg: the sites of request
+func GetTagsByCategory(db *gorm.DB, contentType string, form *TagsForm, scope func(*gorm.DB) *gorm.DB) ([]string, error) {
 	var tx *gorm.DB
 	switch contentType {
-	case "post":
+	case ContentNamePost:
 		tx = db.Model(&Post{})
-	case "page":
+	case ContentNamePage:
 		tx = db.Model(&Page{})
+	default:
+		return nil, ErrInvalidContentType
 	}
+	if scope != nil {
+		tx = scope(tx)
+	}
+	tableName := contentType + "s"
+
+	tx = tx.Joins("JOIN content_tags ON content_tags.site_id = " + tableName + ".site_id AND content_tags.content_id = " + tableName + ".id")
+	tx = tx.Joins("JOIN tags ON tags.id = content_tags.tag_id").Where("content_tags.content", contentType)
 
+	if form.SiteId != "" {
+		tx = tx.Where(tableName+".site_id", form.SiteId)
+	}
+
+	if form.CategoryId != "" {
+		tx = tx.Where(tableName+".category_id", form.CategoryId)
+	}
+
+	if form.CategoryPath != "" {
+		tx = tx.Where(tableName+".category_path", form.CategoryPath)
+	}
+
+	var tags []string = make([]string, 0)
+	r := tx.Distinct("tags.name").Order("tags.name").Pluck("tags.name", &tags)
+	return tags, r.Error
+}
+
+// Query published contents by tags, the tags are matched by slug,
+// the scope limits the contents, the subquery and renders use the db without scope
+func QueryContentByTags(db *gorm.DB, contentType string, form *QueryByTagsForm, scope func(*gorm.DB) *gorm.DB) (*QueryByTagsResult, error) {
+	db = db.Session(&gorm.Session{})
+	var tx *gorm.DB
+	switch contentType {
+	case ContentNamePost:
+		tx = db.Model(&Post{})
+	case ContentNamePage:
+		tx = db.Model(&Page{})
+	default:
+		return nil, ErrInvalidContentType
+	}
+	if scope != nil {
+		tx = scope(tx)
+	}
+
+	tx = WithLiveContents(tx, time.Now())
 	if form.SiteId != "" {
 		tx = tx.Where("site_id", form.SiteId)
 	}
@@ -141,37 +187,65 @@ func GetTagsByCategory(db *gorm.DB, contentType string, form *TagsForm) ([]strin
 		tx = tx.Where("category_path", form.CategoryPath)
 	}
 
-	var rawTags []string
-	r := tx.Pluck("tags", &rawTags)
-	if r.Error != nil {
-		return nil, r.Error
+	var slugs []string
+	for _, tag := range form.Tags {
+		if slug := MakeTagSlug(tag); slug != "" {
+			slugs = append(slugs, slug)
+		}
 	}
+	// the same tag twice must not break the count of match all
+	slugs = uniqueTerms(slugs)
 
-	var uniqueTags map[string]string = make(map[string]string)
-	for _, tag := range rawTags {
-		if tag == "" {
-			continue
-		}
-		vals := strings.Split(tag, ",")
-		for _, val := range vals {
-			val = strings.TrimSpace(val)
-			if val == "" {
-				continue
-			}
-			uniqueTags[strings.ToLower(val)] = val
-		}
+	r := &QueryByTagsResult{
+		Items: make([]any, 0),
+		Limit: form.Limit,
+		Pos:   form.Pos,
+	}
+	if r.Limit <= 0 {
+		r.Limit = DefaultQueryLimit
+	}
+	if r.Limit > MaxQueryLimit {
+		r.Limit = MaxQueryLimit
+	}
+	if r.Pos < 0 {
+		r.Pos = 0
+	}
+	if len(slugs) == 0 {
+		return r, nil
 	}
 
-	var tags []string = make([]string, 0, len(uniqueTags))
-	for k, v := range uniqueTags {
-		if k == "" {
-			continue
-		}
-		tags = append(tags, v)
+	subQuery := db.Model(&ContentTag{}).Select("content_tags.site_id", "content_tags.content_id")
+	subQuery = subQuery.Joins("JOIN tags ON tags.id = content_tags.tag_id")
+	subQuery = subQuery.Where("content_tags.content", contentType).Where("tags.slug IN ?", slugs)
+	if form.Match == TagsMatchAll {
+		subQuery = subQuery.Group("content_tags.site_id, content_tags.content_id")
+		subQuery = subQuery.Having("COUNT(DISTINCT tags.slug) = ?", len(slugs))
 	}
-	return tags, r.Error
-}
+	tx = tx.Where("(site_id, id) IN (?)", subQuery)
+
+	var total int64
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, err
+	}
+	r.Total = int(total)
 
-func QueryContentByTags(db *gorm.DB, contentType string, form *QueryByTagsForm) ([]string, error) {
-	return nil, nil
+	tx = tx.Order("published_at desc").Order("updated_at desc").Offset(r.Pos).Limit(r.Limit)
+	if contentType == ContentNamePost {
+		var vals []Post
+		if err := tx.Find(&vals).Error; err != nil {
+			return nil, err
+		}
+		for i := range vals {
+			r.Items = append(r.Items, NewRenderContentFromPost(db, &vals[i], false))
+		}
+	} else {
+		var vals []Page
+		if err := tx.Find(&vals).Error; err != nil {
+			return nil, err
+		}
+		for i := range vals {
+			r.Items = append(r.Items, NewRenderContentFromPage(db, &vals[i]))
+		}
+	}
+	return r, nil
 }
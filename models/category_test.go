@@ -0,0 +1,52 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestQueryContentByTagsMatchAll(t *testing.T) {
+	db := newTestDB(t)
+	posts := map[string]string{
+		"go":     "Go",
+		"go-web": "Go, Web",
+		"web":    "Web",
+	}
+	for ID, tags := range posts {
+		post := Post{SiteID: "example.com", ID: ID}
+		post.Title = ID
+		post.Published = true
+		post.Tags = tags
+		if err := db.Create(&post).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := SyncContentTags(db, ContentNamePost, post.SiteID, post.ID, tags); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		tags  []string
+		match string
+		want  int
+	}{
+		{"any", []string{"go", "web"}, TagsMatchAny, 3},
+		{"all", []string{"go", "web"}, TagsMatchAll, 1},
+		{"all with the same tag", []string{"go", "go"}, TagsMatchAll, 2},
+		{"all with the same slug", []string{"go", "Go"}, TagsMatchAll, 2},
+		{"all with the same slug and other", []string{"Go", "go", "web"}, TagsMatchAll, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := &QueryByTagsForm{Tags: tt.tags, Match: tt.match}
+			form.SiteId = "example.com"
+			r, err := QueryContentByTags(db, ContentNamePost, form, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Total != tt.want {
+				t.Errorf("total = %d, want %d", r.Total, tt.want)
+			}
+		})
+	}
+}
@@ -34,7 +34,7 @@ type BaseContent struct {
 	UpdatedAt   time.Time    `json:"updatedAt" gorm:"index"`
 	CreatedAt   time.Time    `json:"createdAt" gorm:"index"`
 	Thumbnail   string       `json:"thumbnail,omitempty" gorm:"size:500"`
-	Tags        string       `json:"tags,omitempty" gorm:"size:200;index"`
+	Tags        string       `json:"tags,omitempty" gorm:"type:text"` // the names of content_tags, split by comma
 	Title       string       `json:"title,omitempty" gorm:"size:200"`
 	Alt         string       `json:"alt,omitempty"`
 	Description string       `json:"description,omitempty"`
@@ -44,7 +44,10 @@ type BaseContent struct {
 	Author      string       `json:"author" gorm:"size:64"`
 	Published   bool         `json:"published"`
 	PublishedAt sql.NullTime `json:"publishedAt" gorm:"index"`
+	ScheduledAt sql.NullTime `json:"scheduledAt" gorm:"index"` // the draft is published at, cleared when published
+	UnpublishAt sql.NullTime `json:"unpublishAt" gorm:"index"`
 	ContentType string       `json:"contentType" gorm:"size:32"`
+	State       string       `json:"state,omitempty" gorm:"size:20;index"` // workflow state of pages and posts
 	Remark      string       `json:"remark"`
 }
 
@@ -55,6 +58,7 @@ type SummaryResult struct {
 	CategoryCount int64            `json:"categories"`
 	MediaCount    int64            `json:"media"`
 	LatestPosts   []*RenderContent `json:"latestPosts"`
+	ReviewQueue   []ReviewItem     `json:"reviewQueue"`
 	BuildTime     string           `json:"buildTime"`
 	CanExport     bool             `json:"canExport"`
 }
@@ -67,6 +71,7 @@ type TagsForm struct {
 
 type QueryByTagsForm struct {
 	Tags  []string `json:"tags" binding:"required"`
+	Match string   `json:"match"` // any or all, default is any
 	Limit int      `json:"limit"`
 	Pos   int      `json:"pos"`
 	TagsForm
@@ -78,7 +83,7 @@ type QueryByTagsResult struct {
 	Pos   int   `json:"pos"`
 }
 
-func GetSummary(db *gorm.DB) (result SummaryResult) {
+func GetSummary(db *gorm.DB, user *carrot.User) (result SummaryResult) {
 	db.Model(&Site{}).Count(&result.SiteCount)
 	db.Model(&Page{}).Count(&result.PageCount)
 	db.Model(&Post{}).Count(&result.PostCount)
@@ -93,5 +98,7 @@ func GetSummary(db *gorm.DB) (result SummaryResult) {
 		item.PostBody = ""
 		result.LatestPosts = append(result.LatestPosts, item)
 	}
+
+	result.ReviewQueue, _ = ListReviewQueue(db, "", "", user, DefaultQueryLimit)
 	return result
 }
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/restsend/carrot"
+	"gorm.io/gorm"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	db, err := carrot.InitDatabase(nil, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = carrot.MakeMigrates(db, []any{
+		&Site{},
+		&Page{},
+		&Post{},
+		&Media{},
+		&PublishLog{},
+		&Category{},
+		&Tag{},
+		&ContentTag{},
+		&ApiToken{},
+		&ReviewLog{},
+		&Webhook{},
+		&WebhookDelivery{},
+		&SearchDocument{},
+		&SearchTerm{},
+		&UploadSession{},
+		&MediaReference{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
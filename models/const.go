@@ -15,6 +15,31 @@ const KEY_CMS_MEDIA_HOST = "CMS_MEDIA_HOST"
 const KEY_CMS_API_HOST = "CMS_API_HOST"
 const KEY_CMS_RELATION_COUNT = "CMS_RELATION_COUNT"
 const KEY_CMS_SUGGESTION_COUNT = "CMS_SUGGESTION_COUNT"
+const KEY_CMS_SCHEDULE_INTERVAL = "CMS_SCHEDULE_INTERVAL" // seconds, 0 to disable
+const KEY_CMS_HTML_POLICY = "CMS_HTML_POLICY"
+const KEY_CMS_SANITIZE_ON_SAVE = "CMS_SANITIZE_ON_SAVE"
+const KEY_CMS_SANITIZE_ON_RENDER = "CMS_SANITIZE_ON_RENDER"
+const KEY_CMS_SITEMAP_SIZE = "CMS_SITEMAP_SIZE"
+const KEY_CMS_FEED_SIZE = "CMS_FEED_SIZE"
+const KEY_CMS_FEED_FULL_CONTENT = "CMS_FEED_FULL_CONTENT" // full content or summary
+const KEY_CMS_WEBHOOK_MAX_ATTEMPTS = "CMS_WEBHOOK_MAX_ATTEMPTS"
+const KEY_CMS_WEBHOOK_TIMEOUT = "CMS_WEBHOOK_TIMEOUT" // seconds
+const KEY_CMS_SEARCH_SIZE = "CMS_SEARCH_SIZE"
+const KEY_CMS_STORAGE = "CMS_STORAGE" // local or s3
+const KEY_CMS_S3_ENDPOINT = "CMS_S3_ENDPOINT"
+const KEY_CMS_S3_REGION = "CMS_S3_REGION"
+const KEY_CMS_S3_BUCKET = "CMS_S3_BUCKET"
+const KEY_CMS_S3_ACCESS_KEY = "CMS_S3_ACCESS_KEY"
+const KEY_CMS_S3_SECRET_KEY = "CMS_S3_SECRET_KEY"
+const KEY_CMS_S3_PATH_STYLE = "CMS_S3_PATH_STYLE"
+const KEY_CMS_S3_PUBLIC_URL = "CMS_S3_PUBLIC_URL"                 // empty for private bucket
+const KEY_CMS_IMAGE_VARIANTS = "CMS_IMAGE_VARIANTS"               // name:width[xheight], split by comma, empty to disable
+const KEY_CMS_IMAGE_TRANSFORM_SIZES = "CMS_IMAGE_TRANSFORM_SIZES" // allowed width and height of /media?w=&h=, empty to disable
+const KEY_CMS_IMAGE_CACHE_DIR = "CMS_IMAGE_CACHE_DIR"
+const KEY_CMS_UPLOAD_CHUNK_DIR = "CMS_UPLOAD_CHUNK_DIR"
+const KEY_CMS_UPLOAD_SESSION_EXPIRES = "CMS_UPLOAD_SESSION_EXPIRES" // hours
+const KEY_CMS_MEDIA_SIGN_SECRET = "CMS_MEDIA_SIGN_SECRET"           // the hmac key of signed media url
+const KEY_CMS_MEDIA_SIGNED_EXPIRES = "CMS_MEDIA_SIGNED_EXPIRES"     // seconds
 
 var ErrUnauthorized = errors.New("unauthorized")
 var ErrDraftIsInvalid = errors.New("draft is invalid")
@@ -22,6 +47,36 @@ var ErrPageIsNotPublish = errors.New("page is not publish")
 var ErrPostIsNotPublish = errors.New("post is not publish")
 var ErrInvalidPathAndName = errors.New("invalid path and name")
 var ErrUploadsDirNotConfigured = errors.New("uploads dir not configured")
+var ErrInvalidContentType = errors.New("invalid content type, must be post or page")
+var ErrSiteIsDisallow = errors.New("site is disallow")
+var ErrSitemapNotFound = errors.New("sitemap not found")
+var ErrInvalidFeedFormat = errors.New("invalid feed format, must be rss or atom")
+var ErrApiTokenExpired = errors.New("api token is expired")
+var ErrApiTokenDisabled = errors.New("api token is disabled")
+var ErrApiScopeDenied = errors.New("api token scope denied")
+var ErrInvalidApiScope = errors.New("invalid api scope")
+var ErrSiteScopeDenied = errors.New("site is out of the token scope")
+var ErrPermissionDenied = errors.New("permission denied")
+var ErrInvalidWorkflowAction = errors.New("invalid workflow action for current state")
+var ErrReviewRequired = errors.New("content must be approved before publish")
+var ErrInvalidWebhookUrl = errors.New("invalid webhook url, must be http or https")
+var ErrEmptySearchQuery = errors.New("search query is empty")
+var ErrInvalidStorage = errors.New("invalid storage, must be local or s3")
+var ErrStorageNotConfigured = errors.New("storage is not configured")
+var ErrStorageNotSupported = errors.New("operation is not supported by storage")
+var ErrStorageObjectNotFound = errors.New("storage object not found")
+var ErrUnsupportedImageFormat = errors.New("unsupported image format")
+var ErrInvalidImageTransform = errors.New("invalid image transform")
+var ErrImageSizeNotAllowed = errors.New("image size is not allowed")
+var ErrImageTooLarge = errors.New("image is too large to transform")
+var ErrInvalidUploadSize = errors.New("invalid upload size")
+var ErrUploadOffsetMismatch = errors.New("upload offset mismatch")
+var ErrUploadChunkTooLarge = errors.New("upload chunk exceeds the upload size")
+var ErrUploadIncomplete = errors.New("upload is incomplete")
+var ErrMediaInUse = errors.New("media is used by pages or posts")
+var ErrMediaSignNotConfigured = errors.New("media sign secret is not configured")
+var ErrInvalidMediaSignature = errors.New("invalid media signature")
+var ErrMediaSignatureExpired = errors.New("media signature is expired")
 
 const (
 	ContentTypeHtml     = "html"
@@ -34,10 +89,34 @@ const (
 	ContentTypeFile     = "file"
 )
 const (
+	TagsMatchAny = "any"
+	TagsMatchAll = "all"
+)
+const (
+	DefaultQueryLimit       = 20
+	MaxQueryLimit           = 150
 	DefaultCategoryUUIDSize = 12
 	DefaultPageIDSize       = 14
+	SiteApiKeySize          = 32
+	ApiTokenSize            = 40
 )
 
+const (
+	ApiScopeReadPost  = "read:post"
+	ApiScopeReadPage  = "read:page"
+	ApiScopeReadMedia = "read:media"
+	ApiScopeReadAll   = "read:*"
+	ApiScopeWriteAll  = "write:*"
+)
+
+var ApiScopes = []carrot.AdminSelectOption{
+	{Value: ApiScopeReadPost, Label: "Read posts"},
+	{Value: ApiScopeReadPage, Label: "Read pages"},
+	{Value: ApiScopeReadMedia, Label: "Read media"},
+	{Value: ApiScopeReadAll, Label: "Read all"},
+	{Value: ApiScopeWriteAll, Label: "Write all"},
+}
+
 var ContentTypes = []carrot.AdminSelectOption{
 	{Value: ContentTypeJson, Label: "JSON"},
 	{Value: ContentTypeHtml, Label: "HTML"},
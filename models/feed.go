@@ -0,0 +1,228 @@
+package models
+
+import (
+	"encoding/xml"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	FeedFormatRss  = "rss"
+	FeedFormatAtom = "atom"
+)
+const DefaultFeedSize = 20
+
+type FeedForm struct {
+	SiteID       string
+	CategoryID   string
+	CategoryPath string
+	Tag          string
+	Limit        int
+}
+
+type RssGuid struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type RssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Guid        RssGuid  `xml:"guid"`
+	Description string   `xml:"description,omitempty"`
+	Content     string   `xml:"content:encoded,omitempty"`
+	Creator     string   `xml:"dc:creator,omitempty"`
+	Categories  []string `xml:"category,omitempty"`
+	PubDate     string   `xml:"pubDate,omitempty"`
+}
+
+type RssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	AtomLink      AtomLink  `xml:"atom:link"`
+	Items         []RssItem `xml:"item"`
+}
+
+type RssFeed struct {
+	XMLName      xml.Name   `xml:"rss"`
+	Version      string     `xml:"version,attr"`
+	XmlnsAtom    string     `xml:"xmlns:atom,attr"`
+	XmlnsContent string     `xml:"xmlns:content,attr"`
+	XmlnsDC      string     `xml:"xmlns:dc,attr"`
+	Channel      RssChannel `xml:"channel"`
+}
+
+type AtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type AtomText struct {
+	Type  string `xml:"type,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+type AtomPerson struct {
+	Name string `xml:"name"`
+}
+
+type AtomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type AtomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Link       AtomLink       `xml:"link"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published,omitempty"`
+	Author     *AtomPerson    `xml:"author,omitempty"`
+	Categories []AtomCategory `xml:"category,omitempty"`
+	Summary    *AtomText      `xml:"summary,omitempty"`
+	Content    *AtomText      `xml:"content,omitempty"`
+}
+
+type AtomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []AtomLink  `xml:"link"`
+	Entries []AtomEntry `xml:"entry"`
+}
+
+// The item of feed, Content is the rendered html when full content is enabled
+type FeedItem struct {
+	*RenderContent
+	Link      string
+	Published time.Time
+	Tags      []string
+	Content   string
+}
+
+func (item *FeedItem) categories() []string {
+	var vals []string
+	if item.Category != nil {
+		vals = append(vals, item.Category.Name)
+		if item.Category.PathName != "" {
+			vals = append(vals, item.Category.PathName)
+		}
+	}
+	return append(vals, item.Tags...)
+}
+
+// Query the latest live posts of site for feeds
+func QueryFeedPosts(db *gorm.DB, form *FeedForm) ([]Post, error) {
+	tx := WithLiveContents(db.Model(&Post{}), time.Now()).Where("site_id", form.SiteID)
+	if form.CategoryID != "" {
+		tx = tx.Where("category_id", form.CategoryID)
+	}
+	if form.CategoryPath != "" {
+		tx = tx.Where("category_path", form.CategoryPath)
+	}
+	if slug := MakeTagSlug(form.Tag); slug != "" {
+		subQuery := db.Model(&ContentTag{}).Select("content_tags.content_id")
+		subQuery = subQuery.Joins("JOIN tags ON tags.id = content_tags.tag_id")
+		subQuery = subQuery.Where("content_tags.content", ContentNamePost).Where("content_tags.site_id", form.SiteID).Where("tags.slug", slug)
+		tx = tx.Where("id IN (?)", subQuery)
+	}
+
+	limit := form.Limit
+	if limit <= 0 {
+		limit = DefaultFeedSize
+	}
+	if limit > MaxQueryLimit {
+		limit = MaxQueryLimit
+	}
+
+	var vals []Post
+	r := tx.Order("published_at desc").Order("updated_at desc").Limit(limit).Find(&vals)
+	return vals, r.Error
+}
+
+func NewRssFeed(site *Site, selfUrl string, items []FeedItem) *RssFeed {
+	feed := &RssFeed{
+		Version:      "2.0",
+		XmlnsAtom:    "http://www.w3.org/2005/Atom",
+		XmlnsContent: "http://purl.org/rss/1.0/modules/content/",
+		XmlnsDC:      "http://purl.org/dc/elements/1.1/",
+		Channel: RssChannel{
+			Title:       site.Name,
+			Link:        "https://" + site.Domain,
+			Description: site.Name,
+			AtomLink:    AtomLink{Href: selfUrl, Rel: "self", Type: "application/rss+xml"},
+			Items:       make([]RssItem, 0, len(items)),
+		},
+	}
+
+	var lastBuild time.Time
+	for _, item := range items {
+		if item.UpdatedAt.After(lastBuild) {
+			lastBuild = item.UpdatedAt
+		}
+		feed.Channel.Items = append(feed.Channel.Items, RssItem{
+			Title:       item.Title,
+			Link:        item.Link,
+			Guid:        RssGuid{IsPermaLink: true, Value: item.Link},
+			Description: item.Description,
+			Content:     item.Content,
+			Creator:     item.Author,
+			Categories:  item.categories(),
+			PubDate:     item.Published.Format(time.RFC1123Z),
+		})
+	}
+	if !lastBuild.IsZero() {
+		feed.Channel.LastBuildDate = lastBuild.Format(time.RFC1123Z)
+	}
+	return feed
+}
+
+func NewAtomFeed(site *Site, selfUrl string, items []FeedItem) *AtomFeed {
+	feed := &AtomFeed{
+		Xmlns: "http://www.w3.org/2005/Atom",
+		Title: site.Name,
+		ID:    selfUrl,
+		Links: []AtomLink{
+			{Href: "https://" + site.Domain, Rel: "alternate"},
+			{Href: selfUrl, Rel: "self", Type: "application/atom+xml"},
+		},
+		Entries: make([]AtomEntry, 0, len(items)),
+	}
+
+	var updated time.Time
+	for _, item := range items {
+		if item.UpdatedAt.After(updated) {
+			updated = item.UpdatedAt
+		}
+		entry := AtomEntry{
+			Title:     item.Title,
+			ID:        item.Link,
+			Link:      AtomLink{Href: item.Link, Rel: "alternate"},
+			Updated:   item.UpdatedAt.Format(time.RFC3339),
+			Published: item.Published.Format(time.RFC3339),
+		}
+		if item.Author != "" {
+			entry.Author = &AtomPerson{Name: item.Author}
+		}
+		for _, category := range item.categories() {
+			entry.Categories = append(entry.Categories, AtomCategory{Term: category})
+		}
+		if item.Description != "" {
+			entry.Summary = &AtomText{Type: "text", Value: item.Description}
+		}
+		if item.Content != "" {
+			entry.Content = &AtomText{Type: "html", Value: item.Content}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+	feed.Updated = updated.Format(time.RFC3339)
+	return feed
+}
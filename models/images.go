@@ -0,0 +1,422 @@
+package models
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/restsend/carrot"
+	"gorm.io/gorm"
+)
+
+const (
+	ImageFitCover   = "cover"   // crop to fill the box
+	ImageFitContain = "contain" // keep aspect ratio inside the box
+	ImageFitFill    = "fill"    // stretch to the box
+)
+
+const DefaultImageVariants = "thumb:128x128,small:320,medium:640,large:1280"
+const ImageVariantThumbnail = "thumb"
+const DefaultImageQuality = 85
+const MaxImageVariantPixels = 50 * 1000 * 1000 // the larger images have no variants and are not transformed
+const DefaultImageTransformSizes = "64,128,256,320,480,640,800,1024,1280,1600,1920"
+
+// The size of derived image, the height 0 means keep aspect ratio
+type ImageSize struct {
+	Name   string
+	Width  int
+	Height int
+}
+
+type MediaVariant struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Size   int64  `json:"size"`
+	Ext    string `json:"ext"`
+	Crop   bool   `json:"crop,omitempty"` // cropped to the fixed size, not in srcset
+	Url    string `json:"url,omitempty"`
+}
+
+// Variants of image by name, eg: thumb, small, medium, large
+type MediaVariants map[string]*MediaVariant
+
+// Value always returns the json, gorm gets the column type from the value of zero
+func (s MediaVariants) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+func (s *MediaVariants) Scan(input interface{}) error {
+	var data []byte
+	switch val := input.(type) {
+	case nil:
+		*s = nil
+		return nil
+	case string:
+		data = []byte(val)
+	case []byte:
+		data = val
+	default:
+		return fmt.Errorf("unsupported type of media variants: %T", input)
+	}
+	if len(data) == 0 {
+		*s = nil
+		return nil
+	}
+	return json.Unmarshal(data, s)
+}
+
+// ParseImageSizes parse the config like "thumb:128x128,small:320", the invalid items are ignored
+func ParseImageSizes(val string) []ImageSize {
+	var sizes []ImageSize
+	for _, item := range strings.Split(val, ",") {
+		name, dims, ok := strings.Cut(strings.TrimSpace(item), ":")
+		if !ok || name == "" {
+			continue
+		}
+		size := ImageSize{Name: strings.TrimSpace(name)}
+		w, h, _ := strings.Cut(strings.ToLower(strings.TrimSpace(dims)), "x")
+		size.Width, _ = strconv.Atoi(w)
+		if h != "" {
+			size.Height, _ = strconv.Atoi(h)
+		}
+		if size.Width <= 0 || size.Height < 0 {
+			continue
+		}
+		sizes = append(sizes, size)
+	}
+	return sizes
+}
+
+func GetImageVariantSizes(db *gorm.DB) []ImageSize {
+	return ParseImageSizes(carrot.GetValue(db, KEY_CMS_IMAGE_VARIANTS))
+}
+
+// The variant is png when the original may be transparent, otherwise jpeg
+func getVariantExt(ext string) string {
+	switch ext {
+	case ".png", ".gif":
+		return ".png"
+	}
+	return ".jpg"
+}
+
+// The variants are stored alongside the original, eg: abc.jpg => abc_thumb.jpg
+func GetVariantStorePath(storePath, name, ext string) string {
+	base := storePath
+	if idx := strings.LastIndex(storePath, "."); idx > strings.LastIndex(storePath, "/") {
+		base = storePath[:idx]
+	}
+	return base + "_" + name + ext
+}
+
+// ResizeImage scale the image into width x height by fit mode, the pixels are area averaged.
+// Width or height 0 means keep the aspect ratio of source
+func ResizeImage(src image.Image, width, height int, fit string) image.Image {
+	bounds := src.Bounds()
+	sw, sh := bounds.Dx(), bounds.Dy()
+	if sw == 0 || sh == 0 || (width <= 0 && height <= 0) {
+		return src
+	}
+	if width <= 0 {
+		width = int(math.Round(float64(sw) * float64(height) / float64(sh)))
+		fit = ImageFitFill
+	} else if height <= 0 {
+		height = int(math.Round(float64(sh) * float64(width) / float64(sw)))
+		fit = ImageFitFill
+	}
+	width, height = max1(width), max1(height)
+
+	crop := bounds
+	switch fit {
+	case ImageFitCover:
+		scale := math.Max(float64(width)/float64(sw), float64(height)/float64(sh))
+		cw := int(math.Round(float64(width) / scale))
+		ch := int(math.Round(float64(height) / scale))
+		x0 := bounds.Min.X + (sw-cw)/2
+		y0 := bounds.Min.Y + (sh-ch)/2
+		crop = image.Rect(x0, y0, x0+cw, y0+ch).Intersect(bounds)
+	case ImageFitFill:
+	default:
+		scale := math.Min(float64(width)/float64(sw), float64(height)/float64(sh))
+		width = max1(int(math.Round(float64(sw) * scale)))
+		height = max1(int(math.Round(float64(sh) * scale)))
+	}
+	return scaleImage(src, crop, width, height)
+}
+
+func max1(v int) int {
+	if v < 1 {
+		return 1
+	}
+	return v
+}
+
+// Scale the rect of src to width x height, every target pixel is the average of the source pixels it covers
+func scaleImage(src image.Image, rect image.Rectangle, width, height int) *image.RGBA {
+	rgba := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, rect.Min, draw.Src)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	sw, sh := rect.Dx(), rect.Dy()
+	for y := 0; y < height; y++ {
+		y0 := y * sh / height
+		y1 := (y + 1) * sh / height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0 := x * sw / width
+			x1 := (x + 1) * sw / width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1 && sy < sh; sy++ {
+				off := rgba.PixOffset(x0, sy)
+				for sx := x0; sx < x1 && sx < sw; sx++ {
+					r += uint32(rgba.Pix[off])
+					g += uint32(rgba.Pix[off+1])
+					b += uint32(rgba.Pix[off+2])
+					a += uint32(rgba.Pix[off+3])
+					off += 4
+					n++
+				}
+			}
+			if n == 0 {
+				continue
+			}
+			off := dst.PixOffset(x, y)
+			dst.Pix[off] = uint8(r / n)
+			dst.Pix[off+1] = uint8(g / n)
+			dst.Pix[off+2] = uint8(b / n)
+			dst.Pix[off+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// EncodeImage write the image as jpeg or png by ext
+func EncodeImage(w io.Writer, img image.Image, ext string, quality int) error {
+	switch ext {
+	case ".png":
+		return png.Encode(w, img)
+	case ".jpg", ".jpeg":
+		if quality <= 0 || quality > 100 {
+			quality = DefaultImageQuality
+		}
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	}
+	return ErrUnsupportedImageFormat
+}
+
+// GenerateImageVariants store the derived sizes of image alongside the original,
+// the sizes larger than the original are skipped
+func GenerateImageVariants(storage Storage, storePath, ext string, src image.Image, sizes []ImageSize) (MediaVariants, error) {
+	bounds := src.Bounds()
+	variants := MediaVariants{}
+	variantExt := getVariantExt(ext)
+	for _, size := range sizes {
+		if size.Width >= bounds.Dx() || (size.Height > 0 && size.Height >= bounds.Dy()) {
+			// the original is small enough
+			continue
+		}
+		dst := ResizeImage(src, size.Width, size.Height, ImageFitCover)
+
+		buf := new(bytes.Buffer)
+		if err := EncodeImage(buf, dst, variantExt, DefaultImageQuality); err != nil {
+			return variants, err
+		}
+		key := GetVariantStorePath(storePath, size.Name, variantExt)
+		variant := &MediaVariant{
+			Width:  dst.Bounds().Dx(),
+			Height: dst.Bounds().Dy(),
+			Size:   int64(buf.Len()),
+			Ext:    variantExt,
+			Crop:   size.Height > 0,
+		}
+		if err := storage.Put(key, buf, variant.Size, ""); err != nil {
+			return variants, err
+		}
+		variants[size.Name] = variant
+	}
+	return variants, nil
+}
+
+// RemoveImageVariants delete the stored variants of media
+func RemoveImageVariants(storage Storage, storePath string, variants MediaVariants) {
+	for name, variant := range variants {
+		key := GetVariantStorePath(storePath, name, variant.Ext)
+		if err := storage.Delete(key); err != nil {
+			carrot.Warning("remove image variant failed: ", key, err)
+		}
+	}
+}
+
+// Srcset of the variants and original, eg: "/media/a_small.jpg 320w, /media/a.jpg 1920w"
+func (s MediaVariants) Srcset(originalUrl string, originalWidth int) string {
+	var items []*MediaVariant
+	for _, variant := range s {
+		if variant.Url != "" && !variant.Crop {
+			items = append(items, variant)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Width < items[j].Width })
+	var parts []string
+	for _, item := range items {
+		parts = append(parts, fmt.Sprintf("%s %dw", item.Url, item.Width))
+	}
+	if originalUrl != "" && originalWidth > 0 {
+		parts = append(parts, fmt.Sprintf("%s %dw", originalUrl, originalWidth))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ImageTransform is the resize and encode options of /media, eg: ?w=400&h=300&fit=cover&format=jpeg&q=80
+type ImageTransform struct {
+	Width   int
+	Height  int
+	Fit     string
+	Format  string // ext of output, .jpg or .png
+	Quality int
+}
+
+// ParseImageSizeList parse the allowlist of width and height, eg: "128,320,640"
+func ParseImageSizeList(val string) []int {
+	var sizes []int
+	for _, item := range strings.Split(val, ",") {
+		if size, err := strconv.Atoi(strings.TrimSpace(item)); err == nil && size > 0 {
+			sizes = append(sizes, size)
+		}
+	}
+	return sizes
+}
+
+// ParseImageTransform check the options by the allowlist of sizes,
+// the quality is rounded to tens so the cache is bounded
+func ParseImageTransform(w, h, fit, format, quality string, allowSizes []int) (*ImageTransform, error) {
+	t := &ImageTransform{Fit: fit, Quality: DefaultImageQuality}
+	allowed := func(val string) (int, bool) {
+		if val == "" {
+			return 0, true
+		}
+		size, err := strconv.Atoi(val)
+		if err != nil {
+			return 0, false
+		}
+		for _, v := range allowSizes {
+			if v == size {
+				return size, true
+			}
+		}
+		return 0, false
+	}
+	var ok bool
+	if t.Width, ok = allowed(w); !ok {
+		return nil, ErrImageSizeNotAllowed
+	}
+	if t.Height, ok = allowed(h); !ok {
+		return nil, ErrImageSizeNotAllowed
+	}
+
+	switch fit {
+	case "":
+		t.Fit = ImageFitCover
+	case ImageFitCover, ImageFitContain, ImageFitFill:
+	default:
+		return nil, ErrInvalidImageTransform
+	}
+
+	switch strings.ToLower(format) {
+	case "":
+	case "jpeg", "jpg":
+		t.Format = ".jpg"
+	case "png":
+		t.Format = ".png"
+	default:
+		return nil, ErrUnsupportedImageFormat
+	}
+
+	if quality != "" {
+		q, err := strconv.Atoi(quality)
+		if err != nil || q < 1 || q > 100 {
+			return nil, ErrInvalidImageTransform
+		}
+		t.Quality = (q + 5) / 10 * 10
+		if t.Quality < 10 {
+			t.Quality = 10
+		}
+	}
+	return t, nil
+}
+
+// CacheName is unique by the options, the format is resolved by the ext of original
+func (t *ImageTransform) CacheName(ext string) string {
+	format := t.Format
+	if format == "" {
+		format = getVariantExt(ext)
+	}
+	return fmt.Sprintf("w%d_h%d_%s_q%d%s", t.Width, t.Height, t.Fit, t.Quality, format)
+}
+
+// Transform decode the original, resize and encode it to w
+func (t *ImageTransform) Transform(w io.Writer, reader io.Reader, ext string) error {
+	// check the size by header, decoding the huge image takes too much memory
+	header := new(bytes.Buffer)
+	config, _, err := image.DecodeConfig(io.TeeReader(reader, header))
+	if err != nil {
+		return err
+	}
+	if int64(config.Width)*int64(config.Height) > MaxImageVariantPixels {
+		return ErrImageTooLarge
+	}
+	src, _, err := image.Decode(io.MultiReader(header, reader))
+	if err != nil {
+		return err
+	}
+	format := t.Format
+	if format == "" {
+		format = getVariantExt(ext)
+	}
+
+	bounds := src.Bounds()
+	dst := src
+	// never upscale, unless cover needs to crop
+	if t.Fit == ImageFitCover && t.Width > 0 && t.Height > 0 {
+		dst = ResizeImage(src, t.Width, t.Height, t.Fit)
+	} else if (t.Width > 0 && t.Width < bounds.Dx()) || (t.Height > 0 && t.Height < bounds.Dy()) {
+		dst = ResizeImage(src, t.Width, t.Height, t.Fit)
+	}
+	return EncodeImage(w, dst, format, t.Quality)
+}
+
+// The cache dir of a stored file, all transforms of the file are removed with it
+func GetImageCacheDir(db *gorm.DB, storage, storePath string) string {
+	cacheDir := carrot.GetValue(db, KEY_CMS_IMAGE_CACHE_DIR)
+	if cacheDir == "" {
+		return ""
+	}
+	hash := sha256.Sum256([]byte(storage + ":" + storePath))
+	return filepath.Join(cacheDir, hex.EncodeToString(hash[:16]))
+}
+
+func RemoveImageCache(db *gorm.DB, storage, storePath string) {
+	if dir := GetImageCacheDir(db, storage, storePath); dir != "" {
+		if err := os.RemoveAll(dir); err != nil {
+			carrot.Warning("remove image cache failed: ", dir, err)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseImageTransform(t *testing.T) {
+	sizes := []int{100, 200}
+	tests := []struct {
+		name                       string
+		w, h, fit, format, quality string
+		width, height              int
+		wantFit, wantFormat        string
+		wantQuality                int
+		err                        error
+	}{
+		{name: "defaults", wantFit: ImageFitCover, wantQuality: DefaultImageQuality},
+		{name: "allowed sizes", w: "100", h: "200", fit: ImageFitContain, width: 100, height: 200, wantFit: ImageFitContain, wantQuality: DefaultImageQuality},
+		{name: "jpeg format", format: "JPEG", wantFit: ImageFitCover, wantFormat: ".jpg", wantQuality: DefaultImageQuality},
+		{name: "png format", format: "png", wantFit: ImageFitCover, wantFormat: ".png", wantQuality: DefaultImageQuality},
+		{name: "quality rounded", quality: "74", wantFit: ImageFitCover, wantQuality: 70},
+		{name: "min quality", quality: "1", wantFit: ImageFitCover, wantQuality: 10},
+		{name: "max quality", quality: "100", wantFit: ImageFitCover, wantQuality: 100},
+		{name: "size not allowed", w: "150", err: ErrImageSizeNotAllowed},
+		{name: "invalid size", h: "abc", err: ErrImageSizeNotAllowed},
+		{name: "invalid fit", fit: "stretch", err: ErrInvalidImageTransform},
+		{name: "unsupported format", format: "gif", err: ErrUnsupportedImageFormat},
+		{name: "quality out of range", quality: "101", err: ErrInvalidImageTransform},
+		{name: "invalid quality", quality: "high", err: ErrInvalidImageTransform},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseImageTransform(tt.w, tt.h, tt.fit, tt.format, tt.quality, sizes)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("err = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := ImageTransform{Width: tt.width, Height: tt.height, Fit: tt.wantFit, Format: tt.wantFormat, Quality: tt.wantQuality}
+			if *got != want {
+				t.Errorf("ParseImageTransform() = %+v, want %+v", *got, want)
+			}
+		})
+	}
+}
@@ -1,24 +1,36 @@
 package models
 
 import (
+	"net/url"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/restsend/carrot"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
+// The first segment of the media path in url is the site, eg: /media/@example.com/a.png
+const MediaSitePrefix = "@"
+
 type Media struct {
 	BaseContent
 	Size       int64  `json:"size"`
 	Directory  bool   `json:"directory" gorm:"index"`
-	Path       string `json:"path" gorm:"size:200;uniqueIndex:,composite:_path_name"`
-	Name       string `json:"name" gorm:"size:200;uniqueIndex:,composite:_path_name"`
+	SiteID     string `json:"siteId" gorm:"size:200;not null;default:'';uniqueIndex:,composite:_site_path_name"` // empty is the shared library
+	Path       string `json:"path" gorm:"size:200;uniqueIndex:,composite:_site_path_name"`
+	Name       string `json:"name" gorm:"size:200;uniqueIndex:,composite:_site_path_name"`
 	Ext        string `json:"ext" gorm:"size:100"`
-	Dimensions string `json:"dimensions" gorm:"size:200"` // x*y
+	Dimensions string `json:"dimensions" gorm:"size:200"`       // x*y
+	Storage    string `json:"storage,omitempty" gorm:"size:20"` // local or s3, empty is local
 	StorePath  string `json:"-" gorm:"size:300"`
+	Hash       string `json:"hash,omitempty" gorm:"size:64;index"` // sha256 of file, the media with same hash share the stored file
 	External   bool   `json:"external"`
 	PublicUrl  string `json:"publicUrl,omitempty" gorm:"-"`
+	// derived sizes of image, the url is /media/path/name?variant=small
+	Variants MediaVariants `json:"variants,omitempty"`
+	Srcset   string        `json:"srcset,omitempty" gorm:"-"`
 }
 type MediaFolder struct {
 	Name         string `json:"name"`
@@ -33,7 +45,7 @@ func (m *Media) BuildPublicUrls(mediaHost string, mediaPrefix string) {
 		return
 	}
 
-	publicUrl := filepath.Join(mediaPrefix, m.Path, m.Name)
+	publicUrl := filepath.Join(mediaPrefix, MediaFullPath(m.SiteID, m.Path, m.Name))
 	if mediaHost != "" {
 		if mediaHost[len(mediaHost)-1] == '/' {
 			mediaHost = mediaHost[:len(mediaHost)-1]
@@ -42,16 +54,61 @@ func (m *Media) BuildPublicUrls(mediaHost string, mediaPrefix string) {
 	}
 	m.PublicUrl = publicUrl
 
+	for name, variant := range m.Variants {
+		variant.Url = publicUrl + "?variant=" + url.QueryEscape(name)
+	}
+	if len(m.Variants) > 0 {
+		m.Srcset = m.Variants.Srcset(m.PublicUrl, m.GetWidth())
+	}
+
 	if m.ContentType == ContentTypeImage && m.Thumbnail == "" {
-		m.Thumbnail = m.PublicUrl
+		if thumb, ok := m.Variants[ImageVariantThumbnail]; ok {
+			m.Thumbnail = thumb.Url
+		} else {
+			m.Thumbnail = m.PublicUrl
+		}
+	}
+}
+
+// Width of image from the dimensions, 0 if unknown
+func (m *Media) GetWidth() int {
+	w, _, _ := strings.Cut(strings.ToUpper(m.Dimensions), "X")
+	width, _ := strconv.Atoi(w)
+	return width
+}
+
+// MediaFullPath is the path of media in url, the media of site is under /@domain,
+// eg: /@example.com/logo/a.png, the shared media is /logo/a.png
+func MediaFullPath(siteID, path, name string) string {
+	fullPath := MediaContentID(path, name)
+	if siteID != "" {
+		fullPath = "/" + MediaSitePrefix + siteID + fullPath
+	}
+	return fullPath
+}
+
+// ParseMediaFullPath split the path of url to site, path and name
+func ParseMediaFullPath(fullPath string) (string, string, string) {
+	var siteID string
+	fullPath = filepath.Clean("/" + fullPath)
+	if strings.HasPrefix(fullPath, "/"+MediaSitePrefix) {
+		var rest string
+		siteID, rest, _ = strings.Cut(fullPath[len(MediaSitePrefix)+1:], "/")
+		fullPath = "/" + rest
 	}
+	path, name := splitMediaContentID(fullPath)
+	return siteID, path, name
 }
 
-func CreateFolder(db *gorm.DB, parent, name string, user *carrot.User) (string, error) {
+func CreateFolder(db *gorm.DB, siteID, parent, name string, user *carrot.User) (string, error) {
 	if parent == "" {
 		parent = "/"
 	}
+	if name == "" || (parent == "/" && strings.HasPrefix(name, MediaSitePrefix)) {
+		return "", ErrInvalidPathAndName
+	}
 	obj := Media{
+		SiteID:    siteID,
 		Path:      parent,
 		Name:      name,
 		Directory: true,
@@ -68,9 +125,9 @@ func CreateFolder(db *gorm.DB, parent, name string, user *carrot.User) (string,
 	}).Create(&obj).Error
 }
 
-func ListFolders(db *gorm.DB, path string) ([]MediaFolder, error) {
+func ListFolders(db *gorm.DB, siteID, path string) ([]MediaFolder, error) {
 	var folders []MediaFolder = make([]MediaFolder, 0)
-	tx := db.Model(&Media{}).Select("path", "name").Where("path", path).Where("directory", true)
+	tx := db.Model(&Media{}).Select("path", "name").Where("site_id", siteID).Where("path", path).Where("directory", true)
 	r := tx.Find(&folders)
 	if r.Error != nil {
 		return nil, r.Error
@@ -78,10 +135,39 @@ func ListFolders(db *gorm.DB, path string) ([]MediaFolder, error) {
 	for i := range folders {
 		folder := &folders[i]
 		folder.Path = filepath.Join(folder.Path, folder.Name)
-		tx := db.Model(&Media{}).Where("path", folder.Path)
+		tx := db.Model(&Media{}).Where("site_id", siteID).Where("path", folder.Path)
 		tx.Select("COUNT(*)").Where("directory", true).Find(&folder.FoldersCount)
-		tx = db.Model(&Media{}).Where("path", folder.Path)
+		tx = db.Model(&Media{}).Where("site_id", siteID).Where("path", folder.Path)
 		tx.Select("COUNT(*)").Where("directory", false).Find(&folder.FilesCount)
 	}
 	return folders, r.Error
 }
+
+// MigrateMediaSiteID move the legacy media to the shared library, the column is not null now,
+// the rows added before are NULL and never matched by the empty site
+func MigrateMediaSiteID(db *gorm.DB) error {
+	if db.Migrator().HasColumn(&Media{}, "site_id") {
+		if err := db.Model(&Media{}).Where("site_id IS NULL").UpdateColumn("site_id", "").Error; err != nil {
+			return err
+		}
+	}
+	if db.Migrator().HasColumn(&MediaReference{}, "media_site_id") {
+		if err := db.Model(&MediaReference{}).Where("media_site_id IS NULL").UpdateColumn("media_site_id", "").Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrateMediaSiteIndex drop the unique index of path and name, the same path and name can be in different sites
+func MigrateMediaSiteIndex(db *gorm.DB) error {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(&Media{}); err != nil {
+		return err
+	}
+	name := db.NamingStrategy.IndexName(stmt.Schema.Table, "_path_name")
+	if !db.Migrator().HasIndex(&Media{}, name) {
+		return nil
+	}
+	return db.Migrator().DropIndex(&Media{}, name)
+}
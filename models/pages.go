@@ -37,13 +37,20 @@ type Post struct {
 }
 
 type PublishLog struct {
-	ID        uint        `json:"id" gorm:"primarykey"`
-	CreatedAt time.Time   `json:"createdAt"`
-	AuthorID  uint        `json:"-"`
-	Author    carrot.User `json:"author"`
-	Content   string      `json:"content" gorm:"size:12;index:idx_content_with_id"`    // post_id or page_id
-	ContentID string      `json:"contentId" gorm:"size:100;index:idx_content_with_id"` // post_id or page_id
-	Body      string      `json:"body"`
+	ID            uint        `json:"id" gorm:"primarykey"`
+	CreatedAt     time.Time   `json:"createdAt"`
+	AuthorID      uint        `json:"-"`
+	Author        carrot.User `json:"author"`
+	Content       string      `json:"content" gorm:"size:12;index:idx_content_with_id"` // post or page
+	SiteID        string      `json:"siteId" gorm:"size:200;index:idx_content_with_id"`
+	ContentID     string      `json:"contentId" gorm:"size:100;index:idx_content_with_id"` // post_id or page_id
+	Title         string      `json:"title,omitempty" gorm:"size:200"`
+	Alt           string      `json:"alt,omitempty"`
+	Description   string      `json:"description,omitempty"`
+	Keywords      string      `json:"keywords,omitempty"`
+	ContentAuthor string      `json:"contentAuthor,omitempty" gorm:"size:64"`
+	ContentType   string      `json:"contentType" gorm:"size:32"`
+	Body          string      `json:"body,omitempty"`
 }
 
 type RelationContent struct {
@@ -60,6 +67,9 @@ type RenderContent struct {
 	PageData    any               `json:"data,omitempty"`
 	PostBody    string            `json:"body,omitempty"`
 	IsDraft     bool              `json:"isDraft"`
+	Toc         []TocItem         `json:"toc,omitempty"`
+	WordCount   int               `json:"wordCount,omitempty"`
+	ReadingTime int               `json:"readingTime,omitempty"` // minutes
 	Relations   []RelationContent `json:"relations,omitempty"`
 	Suggestions []RelationContent `json:"suggestions,omitempty"`
 }
@@ -75,55 +85,143 @@ func MakeDuplicate(db *gorm.DB, obj any) error {
 		page.Title = page.Title + "-copy"
 		page.IsDraft = true
 		page.PreviewURL = ""
+		page.State = StateDraft
 		page.Published = false
 		page.CreatedAt = time.Now()
 		page.UpdatedAt = time.Now()
-		return db.Create(page).Error
+		if err := db.Create(page).Error; err != nil {
+			return err
+		}
+		if err := UpdateMediaReferences(db, page); err != nil {
+			return err
+		}
+		return SyncContentTags(db, ContentNamePage, page.SiteID, page.ID, page.Tags)
 	} else if post, ok := obj.(*Post); ok {
 		post.ID = post.ID + "-copy-" + carrot.RandText(3)
 		post.Title = post.Title + "-copy"
 		post.IsDraft = true
 		post.PreviewURL = ""
+		post.State = StateDraft
 		post.CreatedAt = time.Now()
 		post.UpdatedAt = time.Now()
 		post.Published = false
-		return db.Create(post).Error
+		if err := db.Create(post).Error; err != nil {
+			return err
+		}
+		if err := UpdateMediaReferences(db, post); err != nil {
+			return err
+		}
+		return SyncContentTags(db, ContentNamePost, post.SiteID, post.ID, post.Tags)
 	}
 	return errors.New("invalid object, must be page or post")
 }
 
-func MakePublish(db *gorm.DB, siteID, ID string, obj any, publish bool) error {
+func MakePublish(db *gorm.DB, siteID, ID string, obj any, publish bool, user *carrot.User) error {
 	tx := db.Model(obj).Where("site_id", siteID).Where("id", ID)
 	vals := map[string]any{"published": publish}
 
+	if err := db.Where("site_id", siteID).Where("id", ID).Take(obj).Error; err != nil {
+		return err
+	}
+	base, _, _, _ := getWorkflowContent(obj)
+	if base == nil {
+		return ErrInvalidContentType
+	}
+	fromState := base.GetState()
+	toState := fromState
+
 	vals["published"] = publish
 	if publish {
-		vals["body"] = gorm.Expr("draft")
+		if err := CheckCanPublish(db, obj); err != nil {
+			return err
+		}
+		contentType, draft := getContentDraft(obj)
+		vals["body"] = SanitizeOnSave(db, contentType, draft)
 		vals["is_draft"] = false
+		vals["scheduled_at"] = nil
+		toState = StatePublished
+	} else if fromState == StatePublished {
+		toState = StateApproved
+	}
+	vals["state"] = toState
+	if err := tx.Updates(vals).Error; err != nil {
+		return err
+	}
+	if toState != fromState {
+		action := WorkflowPublish
+		if !publish {
+			action = WorkflowUnpublish
+		}
+		if err := CreateReviewLog(db, obj, action, fromState, toState, "", user); err != nil {
+			return err
+		}
+	}
+	if !publish {
+		if err := RemoveSearchIndex(db, GetContentName(obj), siteID, ID); err != nil {
+			carrot.Warning("remove search index failed:", siteID, ID, err)
+		}
+		FireWebhook(db, GetEventName(GetContentName(obj), EventUnpublish), siteID, obj)
+		return nil
+	}
+
+	if err := db.Where("site_id", siteID).Where("id", ID).Take(obj).Error; err != nil {
+		return err
+	}
+	if err := CreatePublishLog(db, obj, user); err != nil {
+		return err
 	}
-	return tx.Updates(vals).Error
+	if err := IndexContent(db, obj); err != nil {
+		carrot.Warning("update search index failed:", siteID, ID, err)
+	}
+	if err := UpdateMediaReferences(db, obj); err != nil {
+		carrot.Warning("update media references failed:", siteID, ID, err)
+	}
+	FireWebhook(db, GetEventName(GetContentName(obj), EventPublish), siteID, obj)
+	return nil
+}
+
+func getContentDraft(obj any) (string, string) {
+	if page, ok := obj.(*Page); ok {
+		return page.ContentType, page.Draft
+	} else if post, ok := obj.(*Post); ok {
+		return post.ContentType, post.Draft
+	}
+	return "", ""
 }
 
 func SafeDraft(db *gorm.DB, siteID, ID string, obj any, draft string) error {
+	var contentType string
+	db.Model(obj).Where("site_id", siteID).Where("id", ID).Select("content_type").Scan(&contentType)
+	draft = SanitizeOnSave(db, contentType, draft)
+
 	tx := db.Model(obj).Where("site_id", siteID).Where("id", ID)
 	vals := map[string]any{
 		"is_draft": true,
 		"draft":    draft,
 	}
-	return tx.Updates(vals).Error
-}
-
-func QueryTags(db *gorm.DB) ([]string, error) {
-	var vals []string
-	r := db.Model(&Post{}).Select("DISTINCT(tags)").Find(&vals)
-	return vals, r.Error
+	if err := tx.Updates(vals).Error; err != nil {
+		return err
+	}
+	if err := db.Where("site_id", siteID).Where("id", ID).Take(obj).Error; err != nil {
+		return err
+	}
+	if err := UpdateMediaReferences(db, obj); err != nil {
+		return err
+	}
+	return resetWorkflowState(db, obj, siteID, ID)
 }
 
 func MakeMediaPublish(db *gorm.DB, siteID, path, name string, obj any, publish bool) error {
-	tx := db.Model(obj).Where("site_id", siteID).Where("path", path).Where("name", name)
+	tx := db.Model(&Media{}).Where("site_id", siteID).Where("path", path).Where("name", name).Where("directory", false)
 	vals := map[string]any{"published": publish}
-	vals["published"] = publish
-	return tx.Updates(vals).Error
+	r := tx.Updates(vals)
+	if r.Error != nil {
+		return r.Error
+	}
+	if r.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
 }
 
 func NewRenderContentFromPage(db *gorm.DB, page *Page) *RenderContent {
@@ -156,6 +254,7 @@ func NewRenderContentFromPost(db *gorm.DB, post *Post, relations bool) *RenderCo
 		IsDraft:     post.IsDraft,
 		Category:    NewRenderCategory(db, post.CategoryID, post.CategoryPath),
 	}
+	r.buildStatistics()
 
 	if relations {
 		relationCount := carrot.GetIntValue(db, KEY_CMS_RELATION_COUNT, 3)
@@ -176,7 +275,7 @@ func GetRelations(db *gorm.DB, siteId, categoryId, categoryPath, postId string,
 		return nil, nil
 	}
 	var r []RelationContent
-	tx := db.Model(&Post{}).Where("site_id", siteId).Where("published", true)
+	tx := WithLiveContents(db.Model(&Post{}), time.Now()).Where("site_id", siteId)
 	if categoryId != "" {
 		tx = tx.Where("category_id", categoryId)
 	}
@@ -0,0 +1,146 @@
+package models
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	gmhtml "github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"golang.org/x/net/html"
+)
+
+const RenderModeHtml = "html"
+const WordsPerMinute = 200
+
+type TocItem struct {
+	Level int    `json:"level"`
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+// The raw html in markdown is kept, the output must be sanitized by HtmlPolicy
+var markdownRender = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+	goldmark.WithRendererOptions(gmhtml.WithUnsafe()),
+)
+
+// RenderMarkdown convert markdown to html, and extract the table of contents from headings
+func RenderMarkdown(source string) (string, []TocItem, error) {
+	src := []byte(source)
+	doc := markdownRender.Parser().Parse(text.NewReader(src))
+
+	var toc []TocItem
+	err := ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := n.(*ast.Heading)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+		item := TocItem{
+			Level: heading.Level,
+			Title: string(heading.Text(src)),
+		}
+		if id, ok := heading.AttributeString("id"); ok {
+			if val, ok := id.([]byte); ok {
+				item.ID = string(val)
+			}
+		}
+		toc = append(toc, item)
+		return ast.WalkSkipChildren, nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := markdownRender.Renderer().Render(&buf, src, doc); err != nil {
+		return "", nil, err
+	}
+	return buf.String(), toc, nil
+}
+
+// ExtractHtmlText return the plain text of html, the script and style are ignored
+func ExtractHtmlText(source string) string {
+	var sb strings.Builder
+	skip := 0
+	z := html.NewTokenizer(strings.NewReader(source))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return sb.String()
+		case html.StartTagToken:
+			name, _ := z.TagName()
+			if tag := string(name); tag == "script" || tag == "style" {
+				skip++
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			if tag := string(name); (tag == "script" || tag == "style") && skip > 0 {
+				skip--
+			}
+		case html.TextToken:
+			if skip == 0 {
+				sb.Write(z.Text())
+				sb.WriteByte(' ')
+			}
+		}
+	}
+}
+
+// CountWords count the words of text, every CJK character is counted as a word
+func CountWords(text string) int {
+	count := 0
+	inWord := false
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			count++
+			inWord = false
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if !inWord {
+				count++
+			}
+			inWord = true
+		default:
+			inWord = false
+		}
+	}
+	return count
+}
+
+// Reading time in minutes
+func GetReadingTime(wordCount int) int {
+	if wordCount <= 0 {
+		return 0
+	}
+	return (wordCount + WordsPerMinute - 1) / WordsPerMinute
+}
+
+func (r *RenderContent) buildStatistics() {
+	body := r.PostBody
+	if r.ContentType == ContentTypeHtml {
+		body = ExtractHtmlText(body)
+	}
+	r.WordCount = CountWords(body)
+	r.ReadingTime = GetReadingTime(r.WordCount)
+}
+
+// RenderHtml convert the markdown body to sanitized html, html body is kept as it is
+func (r *RenderContent) RenderHtml(policy *HtmlPolicy) error {
+	if r.ContentType != ContentTypeMarkdown {
+		return nil
+	}
+	body, toc, err := RenderMarkdown(r.PostBody)
+	if err != nil {
+		return err
+	}
+	r.PostBody = policy.Sanitize(body)
+	r.Toc = toc
+	r.ContentType = ContentTypeHtml
+	return nil
+}
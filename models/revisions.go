@@ -0,0 +1,233 @@
+package models
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/restsend/carrot"
+	"gorm.io/gorm"
+)
+
+const (
+	DiffOpEqual  = " "
+	DiffOpInsert = "+"
+	DiffOpDelete = "-"
+)
+
+var ErrRevisionNotMatch = errors.New("revision not match the content")
+
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+type RevisionDiff struct {
+	From  *PublishLog `json:"from"`
+	To    *PublishLog `json:"to"`
+	Lines []DiffLine  `json:"lines"`
+}
+
+// Get content name of publish log, post or page
+func GetContentName(obj any) string {
+	switch obj.(type) {
+	case *Page:
+		return ContentNamePage
+	case *Post:
+		return ContentNamePost
+	}
+	return ""
+}
+
+func NewPublishLog(obj any, user *carrot.User) (*PublishLog, error) {
+	var log PublishLog
+	if page, ok := obj.(*Page); ok {
+		log.SiteID = page.SiteID
+		log.ContentID = page.ID
+		log.Body = page.Body
+		log.fillFrom(&page.BaseContent)
+	} else if post, ok := obj.(*Post); ok {
+		log.SiteID = post.SiteID
+		log.ContentID = post.ID
+		log.Body = post.Body
+		log.fillFrom(&post.BaseContent)
+	} else {
+		return nil, errors.New("invalid object, must be page or post")
+	}
+	log.Content = GetContentName(obj)
+	if user != nil {
+		log.AuthorID = user.ID
+	}
+	return &log, nil
+}
+
+func (log *PublishLog) fillFrom(content *BaseContent) {
+	log.Title = content.Title
+	log.Alt = content.Alt
+	log.Description = content.Description
+	log.Keywords = content.Keywords
+	log.ContentAuthor = content.Author
+	log.ContentType = content.ContentType
+}
+
+// Snapshot the published content into PublishLog
+func CreatePublishLog(db *gorm.DB, obj any, user *carrot.User) error {
+	log, err := NewPublishLog(obj, user)
+	if err != nil {
+		return err
+	}
+	return db.Omit("Author").Create(log).Error
+}
+
+// Reload the written post or page into obj and snapshot it, used when the content is published by update
+func CreatePublishLogFromDB(db *gorm.DB, obj any, siteID, ID string, user *carrot.User) error {
+	if err := db.Where("site_id", siteID).Where("id", ID).Take(obj).Error; err != nil {
+		return err
+	}
+	return CreatePublishLog(db, obj, user)
+}
+
+// List revisions of the post or page, the body is not included
+func ListRevisions(db *gorm.DB, content, siteID, ID string) ([]PublishLog, error) {
+	var vals []PublishLog = make([]PublishLog, 0)
+	tx := db.Model(&PublishLog{}).Preload("Author").Omit("body")
+	tx = tx.Where("content", content).Where("site_id", siteID).Where("content_id", ID)
+	r := tx.Order("id desc").Find(&vals)
+	return vals, r.Error
+}
+
+func GetRevision(db *gorm.DB, content, siteID, ID string, revisionID uint) (*PublishLog, error) {
+	var obj PublishLog
+	r := db.Model(&PublishLog{}).Preload("Author").Where("id", revisionID).First(&obj)
+	if r.Error != nil {
+		return nil, r.Error
+	}
+	if obj.Content != content || obj.SiteID != siteID || obj.ContentID != ID {
+		return nil, ErrRevisionNotMatch
+	}
+	return &obj, nil
+}
+
+func DiffRevisions(db *gorm.DB, content, siteID, ID string, fromID, toID uint) (*RevisionDiff, error) {
+	from, err := GetRevision(db, content, siteID, ID, fromID)
+	if err != nil {
+		return nil, err
+	}
+	to, err := GetRevision(db, content, siteID, ID, toID)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &RevisionDiff{
+		Lines: DiffText(from.Body, to.Body),
+		From:  from,
+		To:    to,
+	}
+	r.From.Body = ""
+	r.To.Body = ""
+	return r, nil
+}
+
+// Restore the revision body into draft, the published body is untouched
+func RestoreRevision(db *gorm.DB, siteID, ID string, obj any, revisionID uint) error {
+	content := GetContentName(obj)
+	log, err := GetRevision(db, content, siteID, ID, revisionID)
+	if err != nil {
+		return err
+	}
+	return SafeDraft(db, siteID, ID, obj, log.Body)
+}
+
+// Line based diff with the linear space variant of Myers' algorithm, the memory is O(n+m)
+func DiffText(from, to string) []DiffLine {
+	a := strings.Split(from, "\n")
+	b := strings.Split(to, "\n")
+	return diffLines(a, b, make([]DiffLine, 0, len(a)+len(b)))
+}
+
+func diffLines(a, b []string, lines []DiffLine) []DiffLine {
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		lines = append(lines, DiffLine{Op: DiffOpEqual, Text: a[0]})
+		a, b = a[1:], b[1:]
+	}
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	tail := a[len(a)-suffix:]
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+
+	if len(a) == 0 {
+		for _, v := range b {
+			lines = append(lines, DiffLine{Op: DiffOpInsert, Text: v})
+		}
+	} else if len(b) == 0 {
+		for _, v := range a {
+			lines = append(lines, DiffLine{Op: DiffOpDelete, Text: v})
+		}
+	} else {
+		// both sides differ at the first and the last line, so the middle snake splits into smaller diffs
+		x, y, u, v := middleSnake(a, b)
+		lines = diffLines(a[:x], b[:y], lines)
+		for _, line := range a[x:u] {
+			lines = append(lines, DiffLine{Op: DiffOpEqual, Text: line})
+		}
+		lines = diffLines(a[u:], b[v:], lines)
+	}
+
+	for _, v := range tail {
+		lines = append(lines, DiffLine{Op: DiffOpEqual, Text: v})
+	}
+	return lines
+}
+
+// middleSnake return the start (x, y) and the end (u, v) of the middle snake of the shortest edit script
+func middleSnake(a, b []string) (int, int, int, int) {
+	n, m := len(a), len(b)
+	delta := n - m
+	limit := (n + m + 1) / 2
+	offset := limit + 1
+	// the furthest x on diagonal k, the backward one is counted from the end
+	forward := make([]int, 2*limit+3)
+	backward := make([]int, 2*limit+3)
+
+	for d := 0; d <= limit; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			x0, y0 := x, y
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+			if c := delta - k; delta%2 != 0 && c >= -(d-1) && c <= d-1 && x+backward[offset+c] >= n {
+				return x0, y0, x, y
+			}
+		}
+		for c := -d; c <= d; c += 2 {
+			var x int
+			if c == -d || (c != d && backward[offset+c-1] < backward[offset+c+1]) {
+				x = backward[offset+c+1]
+			} else {
+				x = backward[offset+c-1] + 1
+			}
+			y := x - c
+			x0, y0 := x, y
+			for x < n && y < m && a[n-1-x] == b[m-1-y] {
+				x++
+				y++
+			}
+			backward[offset+c] = x
+			if k := delta - c; delta%2 == 0 && k >= -d && k <= d && x+forward[offset+k] >= n {
+				return n - x, m - y, n - x0, m - y0
+			}
+		}
+	}
+	// unreachable, the paths always overlap within (n+m+1)/2 steps
+	return 0, 0, n, m
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffText(t *testing.T) {
+	tests := []struct {
+		name  string
+		from  string
+		to    string
+		lines []DiffLine
+	}{
+		{
+			name:  "equal",
+			from:  "a\nb",
+			to:    "a\nb",
+			lines: []DiffLine{{DiffOpEqual, "a"}, {DiffOpEqual, "b"}},
+		},
+		{
+			name:  "insert",
+			from:  "a\nc",
+			to:    "a\nb\nc",
+			lines: []DiffLine{{DiffOpEqual, "a"}, {DiffOpInsert, "b"}, {DiffOpEqual, "c"}},
+		},
+		{
+			name:  "delete",
+			from:  "a\nb\nc",
+			to:    "a\nc",
+			lines: []DiffLine{{DiffOpEqual, "a"}, {DiffOpDelete, "b"}, {DiffOpEqual, "c"}},
+		},
+		{
+			name:  "replace",
+			from:  "a\nb\nc",
+			to:    "a\nx\nc",
+			lines: []DiffLine{{DiffOpEqual, "a"}, {DiffOpDelete, "b"}, {DiffOpInsert, "x"}, {DiffOpEqual, "c"}},
+		},
+		{
+			name:  "empty from",
+			from:  "",
+			to:    "a",
+			lines: []DiffLine{{DiffOpDelete, ""}, {DiffOpInsert, "a"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DiffText(tt.from, tt.to); !reflect.DeepEqual(got, tt.lines) {
+				t.Errorf("DiffText() = %v, want %v", got, tt.lines)
+			}
+		})
+	}
+}
+
+// The lines must rebuild both texts with the fewest edits
+func TestDiffTextShortest(t *testing.T) {
+	tests := []struct {
+		name  string
+		from  string
+		to    string
+		edits int
+	}{
+		{"myers example", "a\nb\nc\na\nb\nb\na", "c\nb\na\nb\na\nc", 5},
+		{"no common lines", "a\nb", "c\nd\ne", 5},
+		{"moved block", "a\nb\nc\nd\ne", "d\ne\na\nb\nc", 4},
+		// the full LCS table of the inputs takes gigabytes
+		{"large", strings.Repeat("line\n", 100000), "first\n" + strings.Repeat("line\n", 100000) + "last", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var from, to []string
+			edits := 0
+			for _, line := range DiffText(tt.from, tt.to) {
+				switch line.Op {
+				case DiffOpEqual:
+					from = append(from, line.Text)
+					to = append(to, line.Text)
+				case DiffOpDelete:
+					from = append(from, line.Text)
+					edits++
+				case DiffOpInsert:
+					to = append(to, line.Text)
+					edits++
+				}
+			}
+			if strings.Join(from, "\n") != tt.from || strings.Join(to, "\n") != tt.to {
+				t.Fatalf("the lines do not rebuild the texts")
+			}
+			if edits != tt.edits {
+				t.Errorf("edits = %d, want %d", edits, tt.edits)
+			}
+		})
+	}
+}
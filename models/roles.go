@@ -0,0 +1,158 @@
+package models
+
+import (
+	"strings"
+
+	"github.com/restsend/carrot"
+	"gorm.io/gorm"
+)
+
+const (
+	RoleViewer    = "viewer"
+	RoleAuthor    = "author"
+	RoleEditor    = "editor"
+	RolePublisher = "publisher"
+	RoleAdmin     = "admin"
+)
+
+const (
+	PermRead    = "read"
+	PermCreate  = "create"
+	PermUpdate  = "update"
+	PermDelete  = "delete"
+	PermPublish = "publish"
+	PermManage  = "manage" // edit the site and its api key
+)
+
+var RolePermissions = map[string][]string{
+	RoleViewer:    {PermRead},
+	RoleAuthor:    {PermRead, PermCreate, PermUpdate},
+	RoleEditor:    {PermRead, PermCreate, PermUpdate, PermDelete},
+	RolePublisher: {PermRead, PermCreate, PermUpdate, PermDelete, PermPublish},
+	RoleAdmin:     {PermRead, PermCreate, PermUpdate, PermDelete, PermPublish, PermManage},
+}
+
+var Roles = []carrot.AdminSelectOption{
+	{Value: RoleViewer, Label: "Viewer"},
+	{Value: RoleAuthor, Label: "Author"},
+	{Value: RoleEditor, Label: "Editor"},
+	{Value: RolePublisher, Label: "Publisher"},
+	{Value: RoleAdmin, Label: "Admin"},
+}
+
+// ParseRole parse the role of group member, eg: `editor` for all contents, `editor:post` for posts only
+func ParseRole(val string) (role, content string) {
+	role, content, _ = strings.Cut(strings.ToLower(strings.TrimSpace(val)), ":")
+	return role, content
+}
+
+// RoleAllows check the role of group member has the permission on the content
+func RoleAllows(val, content, perm string) bool {
+	role, roleContent := ParseRole(val)
+	if roleContent != "" && content != "" && roleContent != content {
+		return false
+	}
+	for _, v := range RolePermissions[role] {
+		if v == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Get the roles of user in the group of site
+func getUserRoles(db *gorm.DB, userID uint, siteID string) ([]string, error) {
+	groups := db.Model(&Site{}).Select("group_id").Where("group_id > 0").Where("domain", siteID)
+	var roles []string
+	r := db.Model(&carrot.GroupMember{}).Where("user_id", userID).Where("group_id IN (?)", groups).Pluck("role", &roles)
+	return roles, r.Error
+}
+
+// Get the roles of user in the groups without site, they are global roles
+func getGlobalRoles(db *gorm.DB, userID uint) ([]string, error) {
+	groups := db.Model(&Site{}).Select("group_id").Where("group_id > 0")
+	var roles []string
+	r := db.Model(&carrot.GroupMember{}).Where("user_id", userID).Where("group_id NOT IN (?)", groups).Pluck("role", &roles)
+	return roles, r.Error
+}
+
+// CheckPermission check the user can do perm on the content of site.
+// The site without group is open to all staff users, the empty site (eg: shared media library and new site)
+// needs superuser or the admin role in a group without site.
+// The request without user is a guest or an api token without owner, the roles can't be applied,
+// so it's read only, the sites are limited by the site scope of request
+func CheckPermission(db *gorm.DB, user *carrot.User, siteID, content, perm string) error {
+	if user == nil {
+		if perm == PermRead {
+			return nil
+		}
+		return ErrPermissionDenied
+	}
+	if user.IsSuperUser {
+		return nil
+	}
+
+	if siteID == "" {
+		roles, err := getGlobalRoles(db, user.ID)
+		if err != nil {
+			return err
+		}
+		for _, val := range roles {
+			if role, _ := ParseRole(val); role == RoleAdmin && RoleAllows(val, content, perm) {
+				return nil
+			}
+		}
+		return ErrPermissionDenied
+	}
+
+	var site Site
+	if err := db.Select("domain", "group_id").Where("domain", siteID).First(&site).Error; err != nil {
+		return err
+	}
+	if site.GroupID == 0 {
+		return nil
+	}
+
+	roles, err := getUserRoles(db, user.ID, siteID)
+	if err != nil {
+		return err
+	}
+	for _, role := range roles {
+		if RoleAllows(role, content, perm) {
+			return nil
+		}
+	}
+	return ErrPermissionDenied
+}
+
+// PermittedSites return the sites which the user can do perm on the content, all is true when all sites are permitted
+func PermittedSites(db *gorm.DB, user *carrot.User, content, perm string) (sites []string, all bool, err error) {
+	if user == nil {
+		return nil, perm == PermRead, nil
+	}
+	if user.IsSuperUser {
+		return nil, true, nil
+	}
+	var vals []Site
+	if err := db.Model(&Site{}).Select("domain", "group_id").Find(&vals).Error; err != nil {
+		return nil, false, err
+	}
+	var members []carrot.GroupMember
+	r := db.Model(&carrot.GroupMember{}).Select("group_id", "role").Where("user_id", user.ID).Where("group_id IN (?)", db.Model(&Site{}).Select("group_id").Where("group_id > 0")).Find(&members)
+	if r.Error != nil {
+		return nil, false, r.Error
+	}
+	for _, site := range vals {
+		if site.GroupID == 0 {
+			sites = append(sites, site.Domain)
+			continue
+		}
+		for _, member := range members {
+			if member.GroupID == site.GroupID && RoleAllows(member.Role, content, perm) {
+				sites = append(sites, site.Domain)
+				break
+			}
+		}
+	}
+	return sites, len(sites) == len(vals), nil
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/restsend/carrot"
+)
+
+func TestCheckPermission(t *testing.T) {
+	db := newTestDB(t)
+	groups := []carrot.Group{{Name: "site"}, {Name: "global"}}
+	if err := db.Create(&groups).Error; err != nil {
+		t.Fatal(err)
+	}
+	sites := []Site{
+		{Domain: "open.com", Name: "Open"},
+		{Domain: "team.com", Name: "Team", GroupID: groups[0].ID},
+	}
+	if err := db.Create(&sites).Error; err != nil {
+		t.Fatal(err)
+	}
+	users := map[string]*carrot.User{
+		"super":        {Email: "super@example.com", IsSuperUser: true, IsStaff: true},
+		"staff":        {Email: "staff@example.com", IsStaff: true},
+		"site admin":   {Email: "site@example.com", IsStaff: true},
+		"site editor":  {Email: "editor@example.com", IsStaff: true},
+		"global admin": {Email: "admin@example.com", IsStaff: true},
+		"global media": {Email: "media@example.com", IsStaff: true},
+		"global":       {Email: "global@example.com", IsStaff: true},
+	}
+	for _, user := range users {
+		if err := db.Create(user).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	members := []carrot.GroupMember{
+		{UserID: users["site admin"].ID, GroupID: groups[0].ID, Role: RoleAdmin},
+		{UserID: users["site editor"].ID, GroupID: groups[0].ID, Role: RoleEditor},
+		{UserID: users["global admin"].ID, GroupID: groups[1].ID, Role: RoleAdmin},
+		{UserID: users["global media"].ID, GroupID: groups[1].ID, Role: RoleAdmin + ":" + ContentNameMedia},
+		{UserID: users["global"].ID, GroupID: groups[1].ID, Role: RolePublisher},
+	}
+	if err := db.Omit("User", "Group").Create(&members).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		user    string
+		siteID  string
+		content string
+		perm    string
+		allowed bool
+	}{
+		{"", "team.com", ContentNamePost, PermRead, true},
+		{"", "team.com", ContentNamePost, PermCreate, false},
+		{"super", "", ContentNameSite, PermManage, true},
+		{"staff", "open.com", ContentNamePost, PermPublish, true},
+		{"staff", "team.com", ContentNamePost, PermRead, false},
+		{"staff", "", ContentNameMedia, PermCreate, false},
+		{"staff", "", ContentNameSite, PermManage, false},
+		{"site editor", "team.com", ContentNamePost, PermDelete, true},
+		{"site editor", "team.com", ContentNamePost, PermPublish, false},
+		{"site admin", "team.com", ContentNameSite, PermManage, true},
+		{"site admin", "", ContentNameMedia, PermCreate, false},
+		{"global admin", "", ContentNameMedia, PermCreate, true},
+		{"global admin", "", ContentNameSite, PermManage, true},
+		{"global media", "", ContentNameMedia, PermDelete, true},
+		{"global media", "", ContentNameSite, PermManage, false},
+		{"global", "", ContentNameMedia, PermCreate, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.user+" "+tt.perm+" "+tt.content+"@"+tt.siteID, func(t *testing.T) {
+			err := CheckPermission(db, users[tt.user], tt.siteID, tt.content, tt.perm)
+			if tt.allowed && err != nil {
+				t.Errorf("err = %v, want allowed", err)
+			}
+			if !tt.allowed && err != ErrPermissionDenied {
+				t.Errorf("err = %v, want %v", err, ErrPermissionDenied)
+			}
+		})
+	}
+}
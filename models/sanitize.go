@@ -0,0 +1,420 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/restsend/carrot"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"golang.org/x/net/html"
+	"gorm.io/gorm"
+)
+
+// The allowlist of html tags and attributes
+type HtmlPolicy struct {
+	Elements  map[string][]string `json:"elements"`  // tag => attributes, `*` is the attributes of all tags
+	Protocols []string            `json:"protocols"` // allowed schemes of url attributes
+}
+
+var DefaultHtmlPolicy = HtmlPolicy{
+	Elements: map[string][]string{
+		"*":          {"class", "id", "title", "lang", "dir"},
+		"a":          {"href", "target", "rel", "name"},
+		"img":        {"src", "alt", "width", "height", "loading"},
+		"video":      {"src", "poster", "width", "height", "controls", "muted", "loop", "playsinline"},
+		"audio":      {"src", "controls", "loop", "muted"},
+		"source":     {"src", "type"},
+		"figure":     {},
+		"figcaption": {},
+		"p":          {},
+		"br":         {},
+		"hr":         {},
+		"span":       {},
+		"div":        {},
+		"h1":         {},
+		"h2":         {},
+		"h3":         {},
+		"h4":         {},
+		"h5":         {},
+		"h6":         {},
+		"b":          {},
+		"strong":     {},
+		"i":          {},
+		"em":         {},
+		"u":          {},
+		"s":          {},
+		"del":        {},
+		"ins":        {},
+		"sub":        {},
+		"sup":        {},
+		"mark":       {},
+		"small":      {},
+		"blockquote": {"cite"},
+		"q":          {"cite"},
+		"code":       {},
+		"pre":        {},
+		"kbd":        {},
+		"ul":         {},
+		"ol":         {"start", "type"},
+		"li":         {},
+		"dl":         {},
+		"dt":         {},
+		"dd":         {},
+		"table":      {},
+		"caption":    {},
+		"thead":      {},
+		"tbody":      {},
+		"tfoot":      {},
+		"tr":         {},
+		"th":         {"colspan", "rowspan", "align"},
+		"td":         {"colspan", "rowspan", "align"},
+	},
+	Protocols: []string{"http", "https", "mailto", "tel"},
+}
+
+// The content of these tags is dropped when the tag is not allowed
+var rawContentTags = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"iframe":   true,
+	"object":   true,
+	"noscript": true,
+	"template": true,
+	"textarea": true,
+}
+
+var urlAttributes = map[string]bool{
+	"href":   true,
+	"src":    true,
+	"cite":   true,
+	"poster": true,
+	"action": true,
+}
+
+func DefaultHtmlPolicyValue() string {
+	data, _ := json.Marshal(DefaultHtmlPolicy)
+	return string(data)
+}
+
+// Get the html policy from config, the default policy is used if config is invalid
+func GetHtmlPolicy(db *gorm.DB) *HtmlPolicy {
+	val := carrot.GetValue(db, KEY_CMS_HTML_POLICY)
+	if val == "" {
+		return &DefaultHtmlPolicy
+	}
+	var policy HtmlPolicy
+	if err := json.Unmarshal([]byte(val), &policy); err != nil || policy.Elements == nil {
+		carrot.Warning("invalid html policy, use default policy:", KEY_CMS_HTML_POLICY, err)
+		return &DefaultHtmlPolicy
+	}
+	return &policy
+}
+
+func (p *HtmlPolicy) allowAttribute(tag, attr string) bool {
+	if strings.HasPrefix(attr, "on") {
+		return false
+	}
+	for _, v := range p.Elements[tag] {
+		if v == attr {
+			return true
+		}
+	}
+	for _, v := range p.Elements["*"] {
+		if v == attr {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *HtmlPolicy) allowUrl(val string) bool {
+	val = strings.ToLower(strings.TrimSpace(val))
+	idx := strings.IndexAny(val, ":/?#")
+	if idx < 0 || val[idx] != ':' {
+		// relative url
+		return true
+	}
+	scheme := val[:idx]
+	for _, v := range p.Protocols {
+		if v == scheme {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *HtmlPolicy) writeTag(sb *strings.Builder, token html.Token) {
+	sb.WriteByte('<')
+	sb.WriteString(token.Data)
+	for _, attr := range token.Attr {
+		key := strings.ToLower(attr.Key)
+		if attr.Namespace != "" || !p.allowAttribute(token.Data, key) {
+			continue
+		}
+		if urlAttributes[key] && !p.allowUrl(attr.Val) {
+			continue
+		}
+		sb.WriteByte(' ')
+		sb.WriteString(key)
+		sb.WriteString(`="`)
+		sb.WriteString(html.EscapeString(attr.Val))
+		sb.WriteByte('"')
+	}
+	if token.Type == html.SelfClosingTagToken {
+		sb.WriteByte('/')
+	}
+	sb.WriteByte('>')
+}
+
+// Sanitize remove the tags and attributes not in the allowlist, the text of removed tags is kept
+// except script, style and other raw content tags
+func (p *HtmlPolicy) Sanitize(source string) string {
+	var sb strings.Builder
+	skip := 0
+	z := html.NewTokenizer(strings.NewReader(source))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return sb.String()
+		}
+		token := z.Token()
+		_, allowed := p.Elements[token.Data]
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if allowed && skip == 0 {
+				p.writeTag(&sb, token)
+			} else if !allowed && rawContentTags[token.Data] && tt == html.StartTagToken {
+				skip++
+			}
+		case html.EndTagToken:
+			if allowed && skip == 0 {
+				sb.WriteString("</" + token.Data + ">")
+			} else if !allowed && rawContentTags[token.Data] && skip > 0 {
+				skip--
+			}
+		case html.TextToken:
+			if skip == 0 {
+				sb.WriteString(html.EscapeString(token.Data))
+			}
+		}
+	}
+}
+
+// scanLinkDestination return the range of the destination of inline link, pos is after the `(`
+func scanLinkDestination(src []byte, pos int) (int, int) {
+	for pos < len(src) && (src[pos] == ' ' || src[pos] == '\t' || src[pos] == '\n' || src[pos] == '\r') {
+		pos++
+	}
+	start := pos
+	if pos < len(src) && src[pos] == '<' {
+		for pos++; pos < len(src) && src[pos] != '>' && src[pos] != '\n'; pos++ {
+			if src[pos] == '\\' {
+				pos++
+			}
+		}
+		if pos < len(src) {
+			pos++
+		}
+		if pos > len(src) {
+			pos = len(src)
+		}
+		return start, pos
+	}
+	depth := 0
+	for ; pos < len(src); pos++ {
+		c := src[pos]
+		if c == '\\' {
+			pos++
+			continue
+		}
+		if c <= ' ' || (c == ')' && depth == 0) {
+			break
+		}
+		if c == '(' {
+			depth++
+		} else if c == ')' {
+			depth--
+		}
+	}
+	if pos > len(src) {
+		pos = len(src)
+	}
+	return start, pos
+}
+
+// scanLinkEnd return the position after the `)` of inline link, pos is after the destination
+func scanLinkEnd(src []byte, pos int) int {
+	for pos < len(src) && src[pos] != ')' {
+		closer := byte(0)
+		switch src[pos] {
+		case '"', '\'':
+			closer = src[pos]
+		case '(':
+			closer = ')'
+		}
+		if closer != 0 {
+			for pos++; pos < len(src) && src[pos] != closer; pos++ {
+				if src[pos] == '\\' {
+					pos++
+				}
+			}
+		}
+		pos++
+	}
+	if pos < len(src) {
+		pos++
+	}
+	if pos > len(src) {
+		pos = len(src)
+	}
+	return pos
+}
+
+// SanitizeMarkdown sanitize the raw html and the destinations of links and images in markdown,
+// the disallowed destinations are replaced with `<>`, the other markdown syntax is untouched
+func (p *HtmlPolicy) SanitizeMarkdown(source string) string {
+	type segment struct {
+		start, stop int
+		value       string
+	}
+	var segments []segment
+
+	src := []byte(source)
+	pc := parser.NewContext()
+	doc := markdownRender.Parser().Parse(text.NewReader(src), parser.WithContext(pc))
+
+	// the links have no position in ast, so the destinations are located from the end of the link text
+	cursor := 0
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			var destination []byte
+			switch node := n.(type) {
+			case *ast.Link:
+				destination = node.Destination
+			case *ast.Image:
+				destination = node.Destination
+			default:
+				return ast.WalkContinue, nil
+			}
+			cursor = p.sanitizeLinkDestination(src, cursor, html.UnescapeString(string(destination)), func(start, stop int) {
+				segments = append(segments, segment{start, stop, "<>"})
+			})
+			return ast.WalkContinue, nil
+		}
+		if n.Type() == ast.TypeBlock && n.Lines().Len() > 0 && n.Lines().At(0).Start > cursor {
+			cursor = n.Lines().At(0).Start
+		}
+		switch node := n.(type) {
+		case *ast.Text:
+			if node.Segment.Stop > cursor {
+				cursor = node.Segment.Stop
+			}
+		case *ast.AutoLink:
+			label := node.Label(src)
+			if node.AutoLinkType != ast.AutoLinkURL || p.allowUrl(string(node.URL(src))) {
+				break
+			}
+			// keep the url as plain text
+			if idx := bytes.Index(src[cursor:], []byte("<"+string(label)+">")); idx >= 0 {
+				start := cursor + idx
+				cursor = start + len(label) + 2
+				segments = append(segments, segment{start, cursor, string(label)})
+			}
+		case *ast.RawHTML:
+			for i := 0; i < node.Segments.Len(); i++ {
+				seg := node.Segments.At(i)
+				segments = append(segments, segment{seg.Start, seg.Stop, p.Sanitize(string(seg.Value(src)))})
+				if seg.Stop > cursor {
+					cursor = seg.Stop
+				}
+			}
+		case *ast.HTMLBlock:
+			lines := node.Lines()
+			if lines.Len() == 0 {
+				break
+			}
+			seg := segment{start: lines.At(0).Start, stop: lines.At(lines.Len() - 1).Stop}
+			if node.HasClosure() {
+				seg.stop = node.ClosureLine.Stop
+			}
+			seg.value = p.Sanitize(string(src[seg.start:seg.stop]))
+			segments = append(segments, seg)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	// the destinations of reference links are in the definitions
+	for _, ref := range pc.References() {
+		if p.allowUrl(html.UnescapeString(string(ref.Destination()))) {
+			continue
+		}
+		re, err := regexp.Compile(`(?mi)^ {0,3}\[` + regexp.QuoteMeta(string(ref.Label())) + `\]:[ \t]*\r?\n?[ \t]*(<[^<>\n]*>|\S+)`)
+		if err != nil {
+			continue
+		}
+		for _, m := range re.FindAllSubmatchIndex(src, -1) {
+			segments = append(segments, segment{m[2], m[3], "<>"})
+		}
+	}
+
+	if len(segments) == 0 {
+		return source
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].start < segments[j].start })
+
+	var sb strings.Builder
+	pos := 0
+	for _, seg := range segments {
+		if seg.start < pos {
+			continue
+		}
+		sb.Write(src[pos:seg.start])
+		sb.WriteString(seg.value)
+		pos = seg.stop
+	}
+	sb.Write(src[pos:])
+	return sb.String()
+}
+
+// sanitizeLinkDestination locate the destination of inline link or image after cursor, and report
+// the range by replace if it's not allowed, the position after the link is returned
+func (p *HtmlPolicy) sanitizeLinkDestination(src []byte, cursor int, destination string, replace func(start, stop int)) int {
+	idx := bytes.IndexByte(src[cursor:], ']')
+	if idx < 0 {
+		return cursor
+	}
+	pos := cursor + idx + 1
+	if pos >= len(src) || src[pos] != '(' {
+		// reference link
+		return pos
+	}
+	start, stop := scanLinkDestination(src, pos+1)
+	if !p.allowUrl(destination) {
+		replace(start, stop)
+	}
+	return scanLinkEnd(src, stop)
+}
+
+// SanitizeBody sanitize the body by content type, json and text are untouched
+func (p *HtmlPolicy) SanitizeBody(contentType, body string) string {
+	switch contentType {
+	case ContentTypeHtml:
+		return p.Sanitize(body)
+	case ContentTypeMarkdown:
+		return p.SanitizeMarkdown(body)
+	}
+	return body
+}
+
+// Sanitize the body before save if CMS_SANITIZE_ON_SAVE is enabled
+func SanitizeOnSave(db *gorm.DB, contentType, body string) string {
+	if !carrot.GetBoolValue(db, KEY_CMS_SANITIZE_ON_SAVE) {
+		return body
+	}
+	return GetHtmlPolicy(db).SanitizeBody(contentType, body)
+}
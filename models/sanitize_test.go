@@ -0,0 +1,32 @@
+package models
+
+import "testing"
+
+func TestSanitizeMarkdown(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"plain", "# Title\n\n[link](https://example.com) ![img](/a.png)", "# Title\n\n[link](https://example.com) ![img](/a.png)"},
+		{"raw html", "a <b onclick=\"x()\">b</b> <script>alert(1)</script>", "a <b>b</b> alert(1)"},
+		{"html block", "<script>\nalert(1)\n</script>\n\ntext", "\n\ntext"},
+		{"link", "[x](javascript:alert(1))", "[x](<>)"},
+		{"link with title", "[x](JavaScript:alert(1) \"t\")", "[x](<> \"t\")"},
+		{"angle destination", "[x](<javascript:alert(1)>)", "[x](<>)"},
+		{"entity in scheme", "[x](javascript&#58;alert(1))", "[x](<>)"},
+		{"image", "![i](data:text/html;base64,PHNjcmlwdD4=)", "![i](<>)"},
+		{"empty text", "[a](/a)[](javascript:x)", "[a](/a)[](<>)"},
+		{"nested image", "[![i](/a.png)](javascript:x)", "[![i](/a.png)](<>)"},
+		{"autolink", "<javascript:alert(1)> <https://example.com>", "javascript:alert(1) <https://example.com>"},
+		{"reference", "[x][r]\n\n[r]: javascript:alert(1)\n[s]: /ok", "[x][r]\n\n[r]: <>\n[s]: /ok"},
+		{"code", "`[x](javascript:y)`\n\n```\n[x](javascript:y)\n```", "`[x](javascript:y)`\n\n```\n[x](javascript:y)\n```"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DefaultHtmlPolicy.SanitizeMarkdown(tt.source); got != tt.want {
+				t.Errorf("SanitizeMarkdown() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/restsend/carrot"
+	"gorm.io/gorm"
+)
+
+type contentKey struct {
+	SiteID string
+	ID     string
+}
+
+type ScheduleResult struct {
+	Published   int `json:"published"`
+	Unpublished int `json:"unpublished"`
+}
+
+// Content is live when it is published and now is in [PublishedAt, UnpublishAt)
+func (c *BaseContent) IsLive(now time.Time) bool {
+	if !c.Published {
+		return false
+	}
+	if c.PublishedAt.Valid && c.PublishedAt.Time.After(now) {
+		return false
+	}
+	if c.UnpublishAt.Valid && !c.UnpublishAt.Time.After(now) {
+		return false
+	}
+	return true
+}
+
+// Filter the query to live contents only, PublishedAt in future is the embargo of content,
+// the schedule of publish is ScheduledAt, so the live content is never hidden by a scheduled update
+func WithLiveContents(db *gorm.DB, now time.Time) *gorm.DB {
+	return db.Where("published", true).
+		Where("published_at IS NULL OR published_at <= ?", now).
+		Where("unpublish_at IS NULL OR unpublish_at > ?", now)
+}
+
+// RunSchedule promotes the draft of pages and posts whose ScheduledAt arrives,
+// and unpublishes the contents whose UnpublishAt arrives.
+// ScheduledAt is cleared by publish, and only the UnpublishAt set after the last update
+// is handled, so manual publish or unpublish after the schedule time is never overwritten.
+func RunSchedule(db *gorm.DB, now time.Time) (*ScheduleResult, error) {
+	var r ScheduleResult
+	newObjs := []func() any{
+		func() any { return &Page{} },
+		func() any { return &Post{} },
+	}
+
+	for _, newObj := range newObjs {
+		var keys []contentKey
+		tx := db.Model(newObj()).Where("scheduled_at IS NOT NULL").Where("scheduled_at <= ?", now)
+		tx = tx.Where("unpublish_at IS NULL OR unpublish_at > ?", now)
+		if err := tx.Find(&keys).Error; err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			if err := MakePublish(db, key.SiteID, key.ID, newObj(), true, nil); err != nil {
+				if !errors.Is(err, ErrReviewRequired) && !errors.Is(err, ErrInvalidWorkflowAction) {
+					carrot.Warning("schedule publish failed:", key.SiteID, key.ID, err)
+				}
+				// pending until approved
+				continue
+			}
+			r.Published++
+		}
+
+		keys = nil
+		tx = db.Model(newObj()).Where("published", true).Where("unpublish_at IS NOT NULL")
+		tx = tx.Where("unpublish_at <= ?", now).Where("unpublish_at > updated_at")
+		if err := tx.Find(&keys).Error; err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			if err := MakePublish(db, key.SiteID, key.ID, newObj(), false, nil); err != nil {
+				carrot.Warning("schedule unpublish failed:", key.SiteID, key.ID, err)
+				continue
+			}
+			r.Unpublished++
+		}
+	}
+	return &r, nil
+}
+
+// MigrateContentSchedule move the pending schedules in PublishedAt to ScheduledAt,
+// it's called once when the column is added
+func MigrateContentSchedule(db *gorm.DB, now time.Time) error {
+	for _, obj := range []any{&Page{}, &Post{}} {
+		tx := db.Model(obj).Where("scheduled_at IS NULL").Where("published_at > ?", now).Where("published_at > updated_at")
+		if err := tx.UpdateColumn("scheduled_at", gorm.Expr("published_at")).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,605 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+const DefaultSearchSize = 10
+const MaxSearchSize = 100
+const MaxSearchTermSize = 64
+const SearchSnippetSize = 160 // runes
+const searchSyncBatchSize = 500
+
+// The weight of term in each field, title hits rank higher than body hits
+const (
+	searchWeightTitle = 5
+	searchWeightMeta  = 2 // description, keywords and tags
+	searchWeightBody  = 1
+)
+
+// BM25 parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// SearchDocument is the indexed copy of a live post or page,
+// the index is portable across database drivers, no FTS extension is required
+type SearchDocument struct {
+	ID               uint         `json:"id" gorm:"primarykey"`
+	CreatedAt        time.Time    `json:"createdAt"`
+	UpdatedAt        time.Time    `json:"updatedAt"`
+	Content          string       `json:"content" gorm:"size:12;uniqueIndex:idx_search_content"` // post or page
+	SiteID           string       `json:"siteId" gorm:"size:200;uniqueIndex:idx_search_content"`
+	ContentID        string       `json:"contentId" gorm:"size:100;uniqueIndex:idx_search_content"`
+	CategoryID       string       `json:"categoryId,omitempty" gorm:"size:64;index"`
+	CategoryPath     string       `json:"categoryPath,omitempty" gorm:"size:64"`
+	Title            string       `json:"title,omitempty" gorm:"size:200"`
+	Description      string       `json:"description,omitempty"`
+	Thumbnail        string       `json:"thumbnail,omitempty" gorm:"size:500"`
+	Tags             string       `json:"tags,omitempty" gorm:"size:500"`
+	Text             string       `json:"-"` // plain text of body for snippets
+	Length           int          `json:"-"` // count of terms
+	Published        bool         `json:"-"`
+	PublishedAt      sql.NullTime `json:"publishedAt"`
+	UnpublishAt      sql.NullTime `json:"-"`
+	ContentUpdatedAt time.Time    `json:"-"` // the UpdatedAt of content when indexed
+}
+
+type SearchTerm struct {
+	ID         uint   `json:"id" gorm:"primarykey"`
+	DocumentID uint   `json:"documentId" gorm:"index:idx_search_term_document,priority:2"`
+	Term       string `json:"term" gorm:"size:64;index:idx_search_term_document,priority:1"`
+	Freq       int    `json:"freq"` // weighted term frequency
+}
+
+type SearchForm struct {
+	SiteID     string   `json:"siteId"`
+	Query      string   `json:"q"`
+	Contents   []string `json:"contents"` // post, page, empty for both
+	CategoryID string   `json:"categoryId"`
+	Pos        int      `json:"pos"`
+	Limit      int      `json:"limit"`
+}
+
+type SearchItem struct {
+	Content      string       `json:"content"`
+	SiteID       string       `json:"siteId"`
+	ID           string       `json:"id"`
+	CategoryID   string       `json:"categoryId,omitempty"`
+	CategoryPath string       `json:"categoryPath,omitempty"`
+	Title        string       `json:"title"`
+	Description  string       `json:"description,omitempty"`
+	Thumbnail    string       `json:"thumbnail,omitempty"`
+	Tags         string       `json:"tags,omitempty"`
+	PublishedAt  sql.NullTime `json:"publishedAt"`
+	Highlight    string       `json:"highlight"` // title with the terms marked
+	Snippet      string       `json:"snippet"`   // the best matched fragment with the terms marked
+	Score        float64      `json:"score"`
+}
+
+type SearchResult struct {
+	Query string       `json:"q"`
+	Total int          `json:"total"`
+	Pos   int          `json:"pos"`
+	Limit int          `json:"limit"`
+	Items []SearchItem `json:"items"`
+}
+
+type searchHit struct {
+	DocumentID uint
+	Term       string
+	Freq       int
+	Length     int
+}
+
+type searchKey struct {
+	SiteID    string
+	ID        string
+	UpdatedAt time.Time
+	Published bool
+}
+
+// The UpdatedAt of contents synced into the index, by content name
+var searchSyncedAt = struct {
+	sync.Mutex
+	values map[string]time.Time
+}{values: map[string]time.Time{}}
+
+// TokenizeSearchText split text into lower case terms,
+// every CJK character is a term, the same as CountWords
+func TokenizeSearchText(text string) []string {
+	var terms []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			if len(word) > MaxSearchTermSize {
+				word = word[:MaxSearchTermSize]
+			}
+			terms = append(terms, string(word))
+			word = word[:0]
+		}
+	}
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			flush()
+			terms = append(terms, string(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word = append(word, unicode.ToLower(r))
+		default:
+			flush()
+		}
+	}
+	flush()
+	return terms
+}
+
+// Extract the plain text of body for indexing
+func getSearchText(contentType, body string) string {
+	switch contentType {
+	case ContentTypeHtml:
+		return ExtractHtmlText(body)
+	case ContentTypeMarkdown:
+		if r, _, err := RenderMarkdown(body); err == nil {
+			return ExtractHtmlText(r)
+		}
+	case ContentTypeJson:
+		var data any
+		if err := json.Unmarshal([]byte(body), &data); err == nil {
+			var values []string
+			collectJsonStrings(data, &values)
+			return strings.Join(values, " ")
+		}
+	}
+	return body
+}
+
+func collectJsonStrings(data any, values *[]string) {
+	switch val := data.(type) {
+	case string:
+		*values = append(*values, val)
+	case []any:
+		for _, v := range val {
+			collectJsonStrings(v, values)
+		}
+	case map[string]any:
+		for _, v := range val {
+			collectJsonStrings(v, values)
+		}
+	}
+}
+
+func newSearchDocument(obj any) *SearchDocument {
+	var doc SearchDocument
+	var base *BaseContent
+	var body string
+	switch val := obj.(type) {
+	case *Post:
+		base, body = &val.BaseContent, val.Body
+		doc.Content, doc.SiteID, doc.ContentID = ContentNamePost, val.SiteID, val.ID
+		doc.CategoryID, doc.CategoryPath = val.CategoryID, val.CategoryPath
+	case *Page:
+		base, body = &val.BaseContent, val.Body
+		doc.Content, doc.SiteID, doc.ContentID = ContentNamePage, val.SiteID, val.ID
+		doc.CategoryID, doc.CategoryPath = val.CategoryID, val.CategoryPath
+	default:
+		return nil
+	}
+	doc.Title = base.Title
+	doc.Description = base.Description
+	doc.Thumbnail = base.Thumbnail
+	doc.Tags = base.Tags
+	doc.Text = strings.Join(strings.Fields(getSearchText(base.ContentType, body)), " ")
+	doc.Published = base.Published
+	doc.PublishedAt = base.PublishedAt
+	doc.UnpublishAt = base.UnpublishAt
+	doc.ContentUpdatedAt = base.UpdatedAt
+	return &doc
+}
+
+func buildSearchTerms(doc *SearchDocument) map[string]int {
+	freqs := make(map[string]int)
+	fields := []struct {
+		text   string
+		weight int
+	}{
+		{doc.Title, searchWeightTitle},
+		{doc.Description, searchWeightMeta},
+		{doc.Tags, searchWeightMeta},
+		{doc.Text, searchWeightBody},
+	}
+	for _, field := range fields {
+		terms := TokenizeSearchText(field.text)
+		doc.Length += len(terms)
+		for _, term := range terms {
+			freqs[term] += field.weight
+		}
+	}
+	return freqs
+}
+
+// IndexContent update the search index of post or page, the unpublished content is removed from index
+func IndexContent(db *gorm.DB, obj any) error {
+	doc := newSearchDocument(obj)
+	if doc == nil {
+		return ErrInvalidContentType
+	}
+	if !doc.Published {
+		return RemoveSearchIndex(db, doc.Content, doc.SiteID, doc.ContentID)
+	}
+	freqs := buildSearchTerms(doc)
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var current SearchDocument
+		result := tx.Where("content", doc.Content).Where("site_id", doc.SiteID).Where("content_id", doc.ContentID).Limit(1).Find(&current)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			doc.ID = current.ID
+			doc.CreatedAt = current.CreatedAt
+			if err := tx.Where("document_id", doc.ID).Delete(&SearchTerm{}).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Save(doc).Error; err != nil {
+			return err
+		}
+		if len(freqs) == 0 {
+			return nil
+		}
+		terms := make([]SearchTerm, 0, len(freqs))
+		for term, freq := range freqs {
+			terms = append(terms, SearchTerm{DocumentID: doc.ID, Term: term, Freq: freq})
+		}
+		return tx.CreateInBatches(terms, 200).Error
+	})
+}
+
+func RemoveSearchIndex(db *gorm.DB, content, siteID, contentID string) error {
+	var ids []uint
+	err := db.Model(&SearchDocument{}).Where("content", content).Where("site_id", siteID).Where("content_id", contentID).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	return removeSearchDocuments(db, ids)
+}
+
+func removeSearchDocuments(db *gorm.DB, ids []uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("document_id IN (?)", ids).Delete(&SearchTerm{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id IN (?)", ids).Delete(&SearchDocument{}).Error
+	})
+}
+
+// SyncSearchIndex reindex the contents changed since last sync, the unpublished ones are removed.
+// It catches the changes which are not made by MakePublish, eg: edit the title of a published post.
+// The deleted contents are removed by the delete hooks, RebuildSearchIndex cleans the others
+func SyncSearchIndex(db *gorm.DB) (int, error) {
+	searchSyncedAt.Lock()
+	defer searchSyncedAt.Unlock()
+
+	count := 0
+	newObjs := map[string]func() any{
+		ContentNamePage: func() any { return &Page{} },
+		ContentNamePost: func() any { return &Post{} },
+	}
+	for content, newObj := range newObjs {
+		since, ok := searchSyncedAt.values[content]
+		if !ok {
+			// the index is up to date until the latest indexed content
+			var latest SearchDocument
+			if err := db.Where("content", content).Select("content_updated_at").Order("content_updated_at desc").Limit(1).Find(&latest).Error; err != nil {
+				return count, err
+			}
+			since = latest.ContentUpdatedAt
+		}
+
+		// the contents updated at since are checked again, the precision of updated_at may be seconds
+		var keys []searchKey
+		if err := db.Model(newObj()).Where("updated_at >= ?", since).Select("site_id", "id", "updated_at", "published").Order("updated_at").Find(&keys).Error; err != nil {
+			return count, err
+		}
+		for len(keys) > 0 {
+			batch := keys
+			if len(batch) > searchSyncBatchSize {
+				batch = batch[:searchSyncBatchSize]
+			}
+			keys = keys[len(batch):]
+			n, err := syncSearchBatch(db, content, newObj, batch)
+			count += n
+			if err != nil {
+				return count, err
+			}
+			since = batch[len(batch)-1].UpdatedAt
+		}
+		searchSyncedAt.values[content] = since
+	}
+	return count, nil
+}
+
+// syncSearchBatch reindex the published contents of keys which are changed, and remove the unpublished ones
+func syncSearchBatch(db *gorm.DB, content string, newObj func() any, keys []searchKey) (int, error) {
+	count := 0
+	ids := make([]string, 0, len(keys))
+	for _, key := range keys {
+		ids = append(ids, key.ID)
+	}
+	var docs []SearchDocument
+	if err := db.Where("content", content).Where("content_id IN (?)", ids).Select("id", "site_id", "content_id", "content_updated_at").Find(&docs).Error; err != nil {
+		return count, err
+	}
+	indexed := make(map[[2]string]*SearchDocument, len(docs))
+	for i := range docs {
+		indexed[[2]string{docs[i].SiteID, docs[i].ContentID}] = &docs[i]
+	}
+
+	for _, key := range keys {
+		doc, ok := indexed[[2]string{key.SiteID, key.ID}]
+		if !key.Published {
+			if !ok {
+				continue
+			}
+			if err := removeSearchDocuments(db, []uint{doc.ID}); err != nil {
+				return count, err
+			}
+			count++
+			continue
+		}
+		if ok && doc.ContentUpdatedAt.Equal(key.UpdatedAt) {
+			continue
+		}
+		obj := newObj()
+		if err := db.Where("site_id", key.SiteID).Where("id", key.ID).Take(obj).Error; err != nil {
+			return count, err
+		}
+		if err := IndexContent(db, obj); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// RebuildSearchIndex drop the whole index and build it from the published contents
+func RebuildSearchIndex(db *gorm.DB) (int, error) {
+	if err := db.Where("1 = 1").Delete(&SearchTerm{}).Error; err != nil {
+		return 0, err
+	}
+	if err := db.Where("1 = 1").Delete(&SearchDocument{}).Error; err != nil {
+		return 0, err
+	}
+	searchSyncedAt.Lock()
+	searchSyncedAt.values = map[string]time.Time{}
+	searchSyncedAt.Unlock()
+	return SyncSearchIndex(db)
+}
+
+// SearchContents query the live contents of site, ranked by BM25
+func SearchContents(db *gorm.DB, form *SearchForm, now time.Time) (*SearchResult, error) {
+	r := &SearchResult{Query: form.Query, Pos: form.Pos, Limit: form.Limit, Items: []SearchItem{}}
+	if r.Limit <= 0 {
+		r.Limit = DefaultSearchSize
+	}
+	if r.Limit > MaxSearchSize {
+		r.Limit = MaxSearchSize
+	}
+	if r.Pos < 0 {
+		r.Pos = 0
+	}
+
+	terms := uniqueTerms(TokenizeSearchText(form.Query))
+	if len(terms) == 0 {
+		return nil, ErrEmptySearchQuery
+	}
+
+	docs := WithLiveContents(db.Model(&SearchDocument{}), now).Where("search_documents.site_id", form.SiteID)
+	if len(form.Contents) > 0 {
+		docs = docs.Where("search_documents.content IN (?)", form.Contents)
+	}
+	if form.CategoryID != "" {
+		docs = docs.Where("search_documents.category_id", form.CategoryID)
+	}
+
+	var stats struct {
+		Count  int64
+		Length float64
+	}
+	if err := docs.Session(&gorm.Session{}).Select("COUNT(*) AS count, AVG(length) AS length").Scan(&stats).Error; err != nil {
+		return nil, err
+	}
+	if stats.Count == 0 {
+		return r, nil
+	}
+
+	var hits []searchHit
+	err := docs.Session(&gorm.Session{}).
+		Joins("JOIN search_terms ON search_terms.document_id = search_documents.id").
+		Where("search_terms.term IN (?)", terms).
+		Select("search_terms.document_id, search_terms.term, search_terms.freq, search_documents.length").
+		Scan(&hits).Error
+	if err != nil {
+		return nil, err
+	}
+
+	scores := rankSearchHits(hits, float64(stats.Count), stats.Length)
+	ids := make([]uint, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return ids[i] > ids[j]
+	})
+	r.Total = len(ids)
+	if r.Pos >= len(ids) {
+		return r, nil
+	}
+	ids = ids[r.Pos:]
+	if len(ids) > r.Limit {
+		ids = ids[:r.Limit]
+	}
+
+	var items []SearchDocument
+	if err := db.Where("id IN (?)", ids).Find(&items).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]*SearchDocument, len(items))
+	for i := range items {
+		byID[items[i].ID] = &items[i]
+	}
+	for _, id := range ids {
+		doc, ok := byID[id]
+		if !ok {
+			continue
+		}
+		text := doc.Text
+		if text == "" {
+			text = doc.Description
+		}
+		r.Items = append(r.Items, SearchItem{
+			Content:      doc.Content,
+			SiteID:       doc.SiteID,
+			ID:           doc.ContentID,
+			CategoryID:   doc.CategoryID,
+			CategoryPath: doc.CategoryPath,
+			Title:        doc.Title,
+			Description:  doc.Description,
+			Thumbnail:    doc.Thumbnail,
+			Tags:         doc.Tags,
+			PublishedAt:  doc.PublishedAt,
+			Highlight:    HighlightText(doc.Title, terms, 0),
+			Snippet:      HighlightText(text, terms, SearchSnippetSize),
+			Score:        math.Round(scores[id]*1000) / 1000,
+		})
+	}
+	return r, nil
+}
+
+func uniqueTerms(terms []string) []string {
+	seen := make(map[string]bool, len(terms))
+	var r []string
+	for _, term := range terms {
+		if !seen[term] {
+			seen[term] = true
+			r = append(r, term)
+		}
+	}
+	return r
+}
+
+func rankSearchHits(hits []searchHit, count, avgLength float64) map[uint]float64 {
+	if avgLength <= 0 {
+		avgLength = 1
+	}
+	df := make(map[string]float64)
+	for _, hit := range hits {
+		df[hit.Term]++
+	}
+	scores := make(map[uint]float64)
+	for _, hit := range hits {
+		idf := math.Log(1 + (count-df[hit.Term]+0.5)/(df[hit.Term]+0.5))
+		tf := float64(hit.Freq)
+		norm := tf + bm25K1*(1-bm25B+bm25B*float64(hit.Length)/avgLength)
+		scores[hit.DocumentID] += idf * tf * (bm25K1 + 1) / norm
+	}
+	return scores
+}
+
+// HighlightText escape the text as html and wrap the terms with <mark>,
+// the text is cut to the fragment with most terms when maxLen > 0
+func HighlightText(text string, terms []string, maxLen int) string {
+	runes := []rune(text)
+	type span struct{ start, end int }
+	var spans []span
+
+	wanted := make(map[string]bool, len(terms))
+	for _, term := range terms {
+		wanted[term] = true
+	}
+	start := -1
+	check := func(end int) {
+		if start >= 0 && wanted[strings.ToLower(string(runes[start:end]))] {
+			spans = append(spans, span{start, end})
+		}
+		start = -1
+	}
+	for i, r := range runes {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			check(i)
+			start = i
+			check(i + 1)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if start < 0 {
+				start = i
+			}
+		default:
+			check(i)
+		}
+	}
+	check(len(runes))
+
+	from, to := 0, len(runes)
+	if maxLen > 0 && len(runes) > maxLen {
+		// the window with most terms, start a little before the first term
+		best, bestCount := 0, -1
+		for i, s := range spans {
+			count := 0
+			for _, o := range spans[i:] {
+				if o.end-s.start > maxLen {
+					break
+				}
+				count++
+			}
+			if count > bestCount {
+				best, bestCount = s.start, count
+			}
+		}
+		from = best - maxLen/4
+		if from < 0 {
+			from = 0
+		}
+		to = from + maxLen
+		if to > len(runes) {
+			to = len(runes)
+			from = to - maxLen
+		}
+	}
+
+	var sb strings.Builder
+	if from > 0 {
+		sb.WriteString("…")
+	}
+	pos := from
+	for _, s := range spans {
+		if s.start < from || s.end > to {
+			continue
+		}
+		sb.WriteString(html.EscapeString(string(runes[pos:s.start])))
+		sb.WriteString("<mark>")
+		sb.WriteString(html.EscapeString(string(runes[s.start:s.end])))
+		sb.WriteString("</mark>")
+		pos = s.end
+	}
+	sb.WriteString(html.EscapeString(string(runes[pos:to])))
+	if to < len(runes) {
+		sb.WriteString("…")
+	}
+	return sb.String()
+}
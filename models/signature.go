@@ -0,0 +1,116 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/restsend/carrot"
+	"gorm.io/gorm"
+)
+
+const DefaultMediaSignedExpires = 3600 // seconds
+
+// The query of signed media url, eg: /media/a.png?expires=1700000000&filename=a.png&signature=...
+const (
+	MediaQueryExpires   = "expires"
+	MediaQueryFilename  = "filename" // optional, the media is downloaded as the filename
+	MediaQuerySignature = "signature"
+)
+
+// The payload is the full path of media, the unix time of expires and the download filename
+func signMediaPayload(secret, fullPath string, expires int64, filename string) string {
+	payload := fullPath + "\n" + strconv.FormatInt(expires, 10)
+	if filename != "" {
+		payload += "\n" + filename
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func getMediaSignSecret(db *gorm.DB) (string, error) {
+	secret := carrot.GetValue(db, KEY_CMS_MEDIA_SIGN_SECRET)
+	if secret == "" {
+		return "", ErrMediaSignNotConfigured
+	}
+	return secret, nil
+}
+
+// SignMediaQuery return the query which grants the access to media until expiresAt
+func SignMediaQuery(db *gorm.DB, media *Media, expiresAt time.Time, filename string) (url.Values, error) {
+	secret, err := getMediaSignSecret(db)
+	if err != nil {
+		return nil, err
+	}
+	expires := expiresAt.Unix()
+	query := url.Values{}
+	query.Set(MediaQueryExpires, strconv.FormatInt(expires, 10))
+	if filename != "" {
+		query.Set(MediaQueryFilename, filename)
+	}
+	query.Set(MediaQuerySignature, signMediaPayload(secret, MediaFullPath(media.SiteID, media.Path, media.Name), expires, filename))
+	return query, nil
+}
+
+// VerifyMediaSignature check the signature and expires of the query
+func VerifyMediaSignature(db *gorm.DB, media *Media, query url.Values, now time.Time) error {
+	if query.Get(MediaQuerySignature) == "" {
+		return ErrInvalidMediaSignature
+	}
+	secret, err := getMediaSignSecret(db)
+	if err != nil {
+		return err
+	}
+	return verifyMediaSignature(secret, media, query, now)
+}
+
+func verifyMediaSignature(secret string, media *Media, query url.Values, now time.Time) error {
+	signature := query.Get(MediaQuerySignature)
+	if signature == "" {
+		return ErrInvalidMediaSignature
+	}
+	expires, err := strconv.ParseInt(query.Get(MediaQueryExpires), 10, 64)
+	if err != nil {
+		return ErrInvalidMediaSignature
+	}
+	expected := signMediaPayload(secret, MediaFullPath(media.SiteID, media.Path, media.Name), expires, query.Get(MediaQueryFilename))
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrInvalidMediaSignature
+	}
+	if now.Unix() > expires {
+		return ErrMediaSignatureExpired
+	}
+	return nil
+}
+
+type SignedMediaURL struct {
+	Url       string    `json:"url"`
+	ExpiredAt time.Time `json:"expiredAt"`
+}
+
+// BuildSignedMediaURL return the public url of media with signature, expires is seconds,
+// the default expires is used when expires <= 0
+func BuildSignedMediaURL(db *gorm.DB, media *Media, expires int, filename string) (*SignedMediaURL, error) {
+	if media.Directory || strings.ContainsAny(filename, "/\\\r\n") {
+		return nil, ErrInvalidPathAndName
+	}
+	if expires <= 0 {
+		expires = carrot.GetIntValue(db, KEY_CMS_MEDIA_SIGNED_EXPIRES, DefaultMediaSignedExpires)
+	}
+	expiredAt := time.Now().Add(time.Duration(expires) * time.Second)
+	query, err := SignMediaQuery(db, media, expiredAt, filename)
+	if err != nil {
+		return nil, err
+	}
+	obj := *media
+	obj.BuildPublicUrls(carrot.GetValue(db, KEY_CMS_MEDIA_HOST), carrot.GetValue(db, KEY_CMS_MEDIA_PREFIX))
+	return &SignedMediaURL{
+		Url:       obj.PublicUrl + "?" + query.Encode(),
+		ExpiredAt: expiredAt,
+	}, nil
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerifyMediaSignature(t *testing.T) {
+	const secret = "test-secret"
+	media := &Media{SiteID: "example.com", Path: "/docs", Name: "a.pdf"}
+	now := time.Unix(1700000000, 0)
+	fullPath := MediaFullPath(media.SiteID, media.Path, media.Name)
+
+	signed := func(expires int64, filename, signature string) url.Values {
+		query := url.Values{}
+		query.Set(MediaQueryExpires, strconv.FormatInt(expires, 10))
+		if filename != "" {
+			query.Set(MediaQueryFilename, filename)
+		}
+		if signature != "" {
+			query.Set(MediaQuerySignature, signature)
+		}
+		return query
+	}
+	valid := now.Unix() + 60
+	tests := []struct {
+		name  string
+		query url.Values
+		err   error
+	}{
+		{"valid", signed(valid, "", signMediaPayload(secret, fullPath, valid, "")), nil},
+		{"valid with filename", signed(valid, "report.pdf", signMediaPayload(secret, fullPath, valid, "report.pdf")), nil},
+		{"expires at now", signed(now.Unix(), "", signMediaPayload(secret, fullPath, now.Unix(), "")), nil},
+		{"expired", signed(now.Unix()-1, "", signMediaPayload(secret, fullPath, now.Unix()-1, "")), ErrMediaSignatureExpired},
+		{"missing signature", signed(valid, "", ""), ErrInvalidMediaSignature},
+		{"invalid expires", url.Values{MediaQueryExpires: {"soon"}, MediaQuerySignature: {"abc"}}, ErrInvalidMediaSignature},
+		{"expires changed", signed(valid+3600, "", signMediaPayload(secret, fullPath, valid, "")), ErrInvalidMediaSignature},
+		{"filename changed", signed(valid, "other.pdf", signMediaPayload(secret, fullPath, valid, "report.pdf")), ErrInvalidMediaSignature},
+		{"other media", signed(valid, "", signMediaPayload(secret, MediaFullPath("", media.Path, media.Name), valid, "")), ErrInvalidMediaSignature},
+		{"other secret", signed(valid, "", signMediaPayload("other-secret", fullPath, valid, "")), ErrInvalidMediaSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifyMediaSignature(secret, media, tt.query, now); err != tt.err {
+				t.Errorf("verifyMediaSignature() = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package models
+
+import (
+	"encoding/xml"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const SitemapXmlns = "http://www.sitemaps.org/schemas/sitemap/0.9"
+const DefaultSitemapSize = 50000 // the max urls of a sitemap file
+
+type SitemapUrl struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type SitemapUrlSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Urls    []SitemapUrl `xml:"url"`
+}
+
+type SitemapIndex struct {
+	XMLName  xml.Name     `xml:"sitemapindex"`
+	Xmlns    string       `xml:"xmlns,attr"`
+	Sitemaps []SitemapUrl `xml:"sitemap"`
+}
+
+type sitemapRow struct {
+	SiteID       string
+	ID           string
+	CategoryID   string
+	CategoryPath string
+	UpdatedAt    time.Time
+}
+
+func FormatLastMod(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// Count the live pages and posts of site
+func CountSitemapUrls(db *gorm.DB, siteID string) (int64, time.Time, error) {
+	var total int64
+	var lastMod time.Time
+	now := time.Now()
+	for _, obj := range []any{&Page{}, &Post{}} {
+		var count int64
+		tx := WithLiveContents(db.Model(obj), now).Where("site_id", siteID)
+		if err := tx.Count(&count).Error; err != nil {
+			return 0, lastMod, err
+		}
+		total += count
+
+		var row sitemapRow
+		tx = WithLiveContents(db.Model(obj), now).Where("site_id", siteID)
+		if err := tx.Order("updated_at desc").Limit(1).Find(&row).Error; err != nil {
+			return 0, lastMod, err
+		}
+		if row.UpdatedAt.After(lastMod) {
+			lastMod = row.UpdatedAt
+		}
+	}
+	return total, lastMod, nil
+}
+
+// BuildSitemap build the urls of live pages and posts, pos is the offset of all urls, pages first
+func BuildSitemap(db *gorm.DB, site *Site, pos, limit int) (*SitemapUrlSet, error) {
+	r := &SitemapUrlSet{Xmlns: SitemapXmlns, Urls: make([]SitemapUrl, 0)}
+	now := time.Now()
+
+	contents := []struct {
+		name string
+		obj  any
+	}{
+		{ContentNamePage, &Page{}},
+		{ContentNamePost, &Post{}},
+	}
+	for _, content := range contents {
+		if limit <= 0 {
+			break
+		}
+		var count int64
+		tx := WithLiveContents(db.Model(content.obj), now).Where("site_id", site.Domain)
+		if err := tx.Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if int64(pos) >= count {
+			pos -= int(count)
+			continue
+		}
+
+		var rows []sitemapRow
+		tx = WithLiveContents(db.Model(content.obj), now).Where("site_id", site.Domain)
+		// ordered by the stable key, the urls stay in the same sitemap page when contents are updated
+		tx = tx.Order("id").Offset(pos).Limit(limit)
+		if err := tx.Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			r.Urls = append(r.Urls, SitemapUrl{
+				Loc:     site.BuildContentUrl(content.name, row.ID, row.CategoryID, row.CategoryPath),
+				LastMod: FormatLastMod(row.UpdatedAt),
+			})
+		}
+		pos = 0
+		limit -= len(rows)
+	}
+	return r, nil
+}
@@ -2,18 +2,91 @@ package models
 
 import (
 	"fmt"
+	"net/url"
+	"strings"
 	"time"
+
+	"github.com/restsend/carrot"
+	"gorm.io/gorm"
 )
 
+const DefaultPageUrlPattern = "https://{domain}/{id}"
+const DefaultPostUrlPattern = "https://{domain}/post/{id}"
+
 type Site struct {
-	UpdatedAt time.Time `json:"updatedAt"`
-	CreatedAt time.Time `json:"createdAt"`
-	Domain    string    `json:"domain" gorm:"primarykey;size:200"`
-	Name      string    `json:"name" gorm:"size:200"`
-	Preview   string    `json:"preview" gorm:"size:200"`
-	Disallow  bool      `json:"disallow"`
+	UpdatedAt      time.Time    `json:"updatedAt"`
+	CreatedAt      time.Time    `json:"createdAt"`
+	Domain         string       `json:"domain" gorm:"primarykey;size:200"`
+	Name           string       `json:"name" gorm:"size:200"`
+	Preview        string       `json:"preview" gorm:"size:200"`
+	Disallow       bool         `json:"disallow"`
+	PageUrlPattern string       `json:"pageUrlPattern,omitempty" gorm:"size:200"`
+	PostUrlPattern string       `json:"postUrlPattern,omitempty" gorm:"size:200"`
+	ApiKey         string       `json:"-" gorm:"size:64;index"` // read only key of the site, only returned by RegenerateSiteApiKey
+	GroupID        uint         `json:"-"`                      // members and roles of the site, empty is open to all staff
+	Group          carrot.Group `json:"-"`
 }
 
 func (s Site) String() string {
 	return fmt.Sprintf("%s(%s)", s.Name, s.Domain)
 }
+
+// BuildContentUrl build the frontend url of page or post with the url pattern of site,
+// the placeholders are {domain}, {id}, {category} and {categoryPath}
+func (s *Site) BuildContentUrl(content, ID, categoryID, categoryPath string) string {
+	pattern := s.PageUrlPattern
+	if content == ContentNamePost {
+		pattern = s.PostUrlPattern
+		if pattern == "" {
+			pattern = DefaultPostUrlPattern
+		}
+	} else if pattern == "" {
+		pattern = DefaultPageUrlPattern
+	}
+
+	r := strings.NewReplacer(
+		"{domain}", s.Domain,
+		"{id}", url.PathEscape(ID),
+		"{category}", url.PathEscape(categoryID),
+		"{categoryPath}", strings.Trim(categoryPath, "/"),
+	)
+	return r.Replace(pattern)
+}
+
+func GetSite(db *gorm.DB, domain string) (*Site, error) {
+	var obj Site
+	r := db.Where("domain", domain).First(&obj)
+	if r.Error != nil {
+		return nil, r.Error
+	}
+	return &obj, nil
+}
+
+func GetSiteByApiKey(db *gorm.DB, apiKey string) (*Site, error) {
+	if apiKey == "" {
+		return nil, ErrUnauthorized
+	}
+	var obj Site
+	r := db.Where("api_key", apiKey).First(&obj)
+	if r.Error != nil {
+		return nil, r.Error
+	}
+	return &obj, nil
+}
+
+func RegenerateSiteApiKey(db *gorm.DB, domain string) (string, error) {
+	apiKey := carrot.RandText(SiteApiKeySize)
+	r := db.Model(&Site{}).Where("domain", domain).UpdateColumn("api_key", apiKey)
+	if r.Error != nil {
+		return "", r.Error
+	}
+	if r.RowsAffected == 0 {
+		return "", gorm.ErrRecordNotFound
+	}
+	return apiKey, nil
+}
+
+// The domains of disallowed sites, guest can't read the contents of them
+func DisallowSites(db *gorm.DB) *gorm.DB {
+	return db.Model(&Site{}).Select("domain").Where("disallow", true)
+}
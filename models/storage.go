@@ -0,0 +1,170 @@
+package models
+
+import (
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/restsend/carrot"
+	"gorm.io/gorm"
+)
+
+const (
+	StorageLocal = "local"
+	StorageS3    = "s3"
+)
+
+var StorageTypes = []carrot.AdminSelectOption{
+	{Value: StorageLocal, Label: "Local"},
+	{Value: StorageS3, Label: "S3 Compatible"},
+}
+
+type StorageObject struct {
+	Key         string    `json:"key"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"contentType"`
+	ModTime     time.Time `json:"modTime"`
+}
+
+// Storage is the backend of media files, the key is the StorePath of media
+type Storage interface {
+	Name() string
+	// Put the file, size is -1 when unknown
+	Put(key string, reader io.Reader, size int64, contentType string) error
+	Get(key string) (io.ReadCloser, error)
+	Stat(key string) (*StorageObject, error)
+	Delete(key string) error
+	// PublicURL return the url which can be accessed directly, empty when the file must be served by /media
+	PublicURL(key string) string
+	// SignedURL return the url which can be accessed until expires, ErrStorageNotSupported if the backend can't sign
+	SignedURL(key string, expires time.Duration) (string, error)
+}
+
+// StorageFilePutter is implemented by the storage which can take a local file without copy
+type StorageFilePutter interface {
+	PutFile(key, filename string) error
+}
+
+// GetStorage return the storage by name, the empty name is the local storage of legacy media
+func GetStorage(db *gorm.DB, name string) (Storage, error) {
+	switch name {
+	case "", StorageLocal:
+		dir := carrot.GetValue(db, KEY_CMS_UPLOAD_DIR)
+		if dir == "" {
+			return nil, ErrUploadsDirNotConfigured
+		}
+		return &LocalStorage{Dir: dir}, nil
+	case StorageS3:
+		return NewS3Storage(db)
+	}
+	return nil, ErrInvalidStorage
+}
+
+// GetDefaultStorage return the storage for new uploads, selected by CMS_STORAGE
+func GetDefaultStorage(db *gorm.DB) (Storage, error) {
+	return GetStorage(db, carrot.GetValue(db, KEY_CMS_STORAGE))
+}
+
+func getStorageContentType(key, contentType string) string {
+	if contentType == "" {
+		contentType = mime.TypeByExtension(strings.ToLower(filepath.Ext(key)))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return contentType
+}
+
+// LocalStorage store the files in the upload dir
+type LocalStorage struct {
+	Dir string
+}
+
+func (s *LocalStorage) Name() string {
+	return StorageLocal
+}
+
+// The key is always inside the dir
+func (s *LocalStorage) fullPath(key string) string {
+	return filepath.Join(s.Dir, filepath.Clean("/"+key))
+}
+
+func (s *LocalStorage) Put(key string, reader io.Reader, size int64, contentType string) error {
+	fullPath := s.fullPath(key)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(fullPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, reader); err != nil {
+		f.Close()
+		os.Remove(fullPath)
+		return err
+	}
+	return f.Close()
+}
+
+// PutFile move the file into dir, copy it when the file is in other device
+func (s *LocalStorage) PutFile(key, filename string) error {
+	fullPath := s.fullPath(key)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(filename, fullPath); err == nil {
+		return os.Chmod(fullPath, 0644)
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return s.Put(key, f, -1, "")
+}
+
+func (s *LocalStorage) Get(key string) (io.ReadCloser, error) {
+	f, err := os.Open(s.fullPath(key))
+	if os.IsNotExist(err) {
+		return nil, ErrStorageObjectNotFound
+	}
+	return f, err
+}
+
+func (s *LocalStorage) Stat(key string) (*StorageObject, error) {
+	st, err := os.Stat(s.fullPath(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrStorageObjectNotFound
+		}
+		return nil, err
+	}
+	if st.IsDir() {
+		return nil, ErrStorageObjectNotFound
+	}
+	return &StorageObject{
+		Key:         key,
+		Size:        st.Size(),
+		ContentType: getStorageContentType(key, ""),
+		ModTime:     st.ModTime(),
+	}, nil
+}
+
+func (s *LocalStorage) Delete(key string) error {
+	err := os.Remove(s.fullPath(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *LocalStorage) PublicURL(key string) string {
+	return ""
+}
+
+func (s *LocalStorage) SignedURL(key string, expires time.Duration) (string, error) {
+	return "", ErrStorageNotSupported
+}
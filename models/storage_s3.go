@@ -0,0 +1,286 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/restsend/carrot"
+	"gorm.io/gorm"
+)
+
+const s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+const s3MaxSignedExpires = 7 * 24 * time.Hour
+
+// S3Storage store the files in a bucket of S3 or compatible service (MinIO, R2, OSS ...),
+// the requests are signed with AWS Signature Version 4
+type S3Storage struct {
+	Endpoint  string // eg: https://s3.us-east-1.amazonaws.com or http://127.0.0.1:9000
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool   // bucket in path instead of host, MinIO requires it
+	PublicUrl string // the base url of public bucket or CDN, empty means private bucket
+	Client    *http.Client
+}
+
+func NewS3Storage(db *gorm.DB) (*S3Storage, error) {
+	s := &S3Storage{
+		Endpoint:  strings.TrimSuffix(carrot.GetValue(db, KEY_CMS_S3_ENDPOINT), "/"),
+		Region:    carrot.GetValue(db, KEY_CMS_S3_REGION),
+		Bucket:    carrot.GetValue(db, KEY_CMS_S3_BUCKET),
+		AccessKey: carrot.GetValue(db, KEY_CMS_S3_ACCESS_KEY),
+		SecretKey: carrot.GetValue(db, KEY_CMS_S3_SECRET_KEY),
+		PathStyle: carrot.GetBoolValue(db, KEY_CMS_S3_PATH_STYLE),
+		PublicUrl: strings.TrimSuffix(carrot.GetValue(db, KEY_CMS_S3_PUBLIC_URL), "/"),
+		Client:    http.DefaultClient,
+	}
+	if s.Endpoint == "" || s.Bucket == "" {
+		return nil, ErrStorageNotConfigured
+	}
+	if s.Region == "" {
+		s.Region = "us-east-1"
+	}
+	if _, err := url.Parse(s.Endpoint); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *S3Storage) Name() string {
+	return StorageS3
+}
+
+func (s *S3Storage) objectUrl(key string) *url.URL {
+	u, _ := url.Parse(s.Endpoint)
+	key = strings.TrimPrefix(key, "/")
+	if s.PathStyle {
+		u.Path = "/" + s.Bucket + "/" + key
+	} else {
+		u.Host = s.Bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	u.RawPath = s3Escape(u.Path, false)
+	return u
+}
+
+func (s *S3Storage) Put(key string, reader io.Reader, size int64, contentType string) error {
+	req, err := http.NewRequest(http.MethodPut, s.objectUrl(key).String(), reader)
+	if err != nil {
+		return err
+	}
+	if size == 0 {
+		req.Body = http.NoBody
+	} else if size > 0 {
+		req.ContentLength = size
+	}
+	req.Header.Set("Content-Type", getStorageContentType(key, contentType))
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3Storage) Get(key string) (io.ReadCloser, error) {
+	req, err := http.NewRequest(http.MethodGet, s.objectUrl(key).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *S3Storage) Stat(key string) (*StorageObject, error) {
+	req, err := http.NewRequest(http.MethodHead, s.objectUrl(key).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	obj := &StorageObject{
+		Key:         key,
+		Size:        resp.ContentLength,
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+	if val, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		obj.ModTime = val
+	}
+	return obj, nil
+}
+
+func (s *S3Storage) Delete(key string) error {
+	req, err := http.NewRequest(http.MethodDelete, s.objectUrl(key).String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		if err == ErrStorageObjectNotFound {
+			return nil
+		}
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3Storage) PublicURL(key string) string {
+	if s.PublicUrl == "" {
+		return ""
+	}
+	return s.PublicUrl + s3Escape("/"+strings.TrimPrefix(key, "/"), false)
+}
+
+// SignedURL is the presigned GET url, the max expires of S3 is 7 days
+func (s *S3Storage) SignedURL(key string, expires time.Duration) (string, error) {
+	if expires <= 0 || expires > s3MaxSignedExpires {
+		expires = s3MaxSignedExpires
+	}
+	return s.presign(key, expires, time.Now().UTC()), nil
+}
+
+func (s *S3Storage) presign(key string, expires time.Duration, now time.Time) string {
+	u := s.objectUrl(key)
+	amzDate := now.Format("20060102T150405Z")
+	scope := s.credentialScope(now)
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", s.AccessKey+"/"+scope)
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	u.RawQuery = s3CanonicalQuery(query)
+
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		u.EscapedPath(),
+		u.RawQuery,
+		"host:" + u.Host + "\n",
+		"host",
+		s3UnsignedPayload,
+	}, "\n")
+	u.RawQuery += "&X-Amz-Signature=" + s.sign(now, amzDate, scope, canonicalRequest)
+	return u.String()
+}
+
+// Sign the request with headers and check the response status
+func (s *S3Storage) do(req *http.Request) (*http.Response, error) {
+	s.signRequest(req, time.Now().UTC())
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrStorageObjectNotFound
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	carrot.Warning("s3 request failed: ", req.Method, req.URL.Path, resp.StatusCode, string(body))
+	return nil, fmt.Errorf("s3 %s %s failed, code:%d %s", req.Method, req.URL.Path, resp.StatusCode, string(body))
+}
+
+// signRequest set the Authorization header, the payload is unsigned if X-Amz-Content-Sha256 is not set
+func (s *S3Storage) signRequest(req *http.Request, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	scope := s.credentialScope(now)
+
+	payloadHash := req.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		payloadHash = s3UnsignedPayload
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	signedHeaders := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+	signature := s.sign(now, amzDate, scope, canonicalRequest)
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, strings.Join(signedHeaders, ";"), signature))
+}
+
+func (s *S3Storage) credentialScope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.Region + "/s3/aws4_request"
+}
+
+func (s *S3Storage) sign(now time.Time, amzDate, scope, canonicalRequest string) string {
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := s3Hmac([]byte("AWS4"+s.SecretKey), now.Format("20060102"))
+	key = s3Hmac(key, s.Region)
+	key = s3Hmac(key, "s3")
+	key = s3Hmac(key, "aws4_request")
+	return hex.EncodeToString(s3Hmac(key, stringToSign))
+}
+
+func s3Hmac(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vals := append([]string{}, query[k]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			parts = append(parts, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// URI encode of AWS, only the unreserved characters are kept
+func s3Escape(s string, encodeSlash bool) string {
+	var sb strings.Builder
+	for _, b := range []byte(s) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9', b == '-', b == '_', b == '.', b == '~':
+			sb.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			sb.WriteByte(b)
+		default:
+			fmt.Fprintf(&sb, "%%%02X", b)
+		}
+	}
+	return sb.String()
+}
@@ -1,7 +1,8 @@
 package models
 
 import (
-	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"image"
@@ -20,42 +21,54 @@ import (
 	"gorm.io/gorm"
 )
 
+const maxExternalResponseSize = 1024 * 1024
+
 type UploadResult struct {
-	PublicUrl   string `json:"publicUrl"`
-	Thumbnail   string `json:"thumbnail"`
-	Path        string `json:"path"`
-	Name        string `json:"name"`
-	External    bool   `json:"external"`
-	StorePath   string `json:"storePath"`
-	Dimensions  string `json:"dimensions"`
-	Ext         string `json:"ext"`
-	Size        int64  `json:"size"`
-	ContentType string `json:"contentType"`
+	PublicUrl   string        `json:"publicUrl"`
+	Thumbnail   string        `json:"thumbnail"`
+	SiteID      string        `json:"siteId,omitempty"`
+	Path        string        `json:"path"`
+	Name        string        `json:"name"`
+	External    bool          `json:"external"`
+	Storage     string        `json:"storage"`
+	StorePath   string        `json:"storePath"`
+	Dimensions  string        `json:"dimensions"`
+	Variants    MediaVariants `json:"variants,omitempty"`
+	Srcset      string        `json:"srcset,omitempty"`
+	Ext         string        `json:"ext"`
+	Size        int64         `json:"size"`
+	Hash        string        `json:"hash"` // sha256 of file
+	ContentType string        `json:"contentType"`
+	// the same file is already stored, the stored file is shared with the media at ExistsPath
+	Exists     bool   `json:"exists,omitempty"`
+	ExistsPath string `json:"existsPath,omitempty"`
 }
 
-func RemoveDirectory(db *gorm.DB, path string) (string, error) {
+func RemoveDirectory(db *gorm.DB, siteID, path string) (string, error) {
 	var files []Media
-	r := db.Model(&Media{}).Where("path", path).Find(&files)
+	r := db.Model(&Media{}).Where("site_id", siteID).Where("path", path).Find(&files)
 	if r.Error != nil {
 		carrot.Warning("Remove directory failed: ", r.Error, path)
 		return "", r.Error
 	}
 
-	uploadDir := carrot.GetValue(db, KEY_CMS_UPLOAD_DIR)
-	for _, media := range files {
+	for i := range files {
+		media := &files[i]
 		if media.Directory {
-			RemoveDirectory(db, filepath.Join(path, media.Name))
+			RemoveDirectory(db, siteID, filepath.Join(path, media.Name))
 			continue
 		}
-		if !media.External {
-			fullPath := filepath.Join(uploadDir, media.StorePath)
-			if err := os.Remove(fullPath); err != nil {
-				carrot.Warning("Remove file failed: ", err, fullPath)
-			}
+		// delete the row first, the shared file of the media in the same directory is removed by the last one
+		if err := db.Where("site_id", siteID).Where("path", media.Path).Where("name", media.Name).Delete(&Media{}).Error; err != nil {
+			return "", err
+		}
+		if err := RemoveMediaFile(db, media); err != nil {
+			carrot.Warning("Remove file failed: ", err, media.Storage, media.StorePath)
 		}
+		RemoveContentTags(db, ContentNameMedia, siteID, MediaContentID(media.Path, media.Name))
 	}
 
-	r = db.Where("path", path).Delete(&Media{})
+	r = db.Where("site_id", siteID).Where("path", path).Delete(&Media{})
 	if r.Error != nil {
 		return "", r.Error
 	}
@@ -64,79 +77,106 @@ func RemoveDirectory(db *gorm.DB, path string) (string, error) {
 	if parent != "/" {
 		parent = strings.TrimSuffix(parent, "/")
 	}
-	return parent, db.Where("path", parent).Where("name", name).Delete(&Media{}).Error
+	return parent, db.Where("site_id", siteID).Where("path", parent).Where("name", name).Delete(&Media{}).Error
 }
 
-func RemoveFile(db *gorm.DB, path, name string) error {
+func RemoveFile(db *gorm.DB, siteID, path, name string) error {
 	if name == "" {
 		return ErrInvalidPathAndName
 	}
 
-	media, err := GetMedia(db, path, name)
+	media, err := GetMedia(db, siteID, path, name)
 	if err != nil {
 		return err
 	}
+	return RemoveMediaFile(db, media)
+}
 
-	if !media.External {
+// RemoveMediaFile delete the stored file of media, the external file is kept,
+// and the file shared with other media is kept until the last one is removed
+func RemoveMediaFile(db *gorm.DB, media *Media) error {
+	if media.External || media.Directory || media.StorePath == "" {
 		return nil
 	}
-
-	uploadDir := carrot.GetValue(db, KEY_CMS_UPLOAD_DIR)
-	fullPath := filepath.Join(uploadDir, media.StorePath)
-	if err := os.Remove(fullPath); err != nil {
+	refs, err := CountMediaReferences(db, media)
+	if err != nil {
+		return err
+	}
+	if refs > 0 {
+		return nil
+	}
+	storage, err := GetStorage(db, media.Storage)
+	if err != nil {
 		return err
 	}
-	return nil
+	RemoveImageVariants(storage, media.StorePath, media.Variants)
+	RemoveImageCache(db, storage.Name(), media.StorePath)
+	return storage.Delete(media.StorePath)
 }
 
-func PrepareStoreLocalDir(db *gorm.DB) (string, error) {
-	uploadDir := carrot.GetValue(db, KEY_CMS_UPLOAD_DIR)
-	if uploadDir == "" {
-		return "", ErrUploadsDirNotConfigured
+// The legacy media without storage is in local storage
+func whereMediaStorage(tx *gorm.DB, storage string) *gorm.DB {
+	if storage == "" || storage == StorageLocal {
+		return tx.Where("storage IN ?", []string{"", StorageLocal})
 	}
+	return tx.Where("storage", storage)
+}
 
-	if _, err := os.Stat(uploadDir); err != nil {
-		if os.IsNotExist(err) {
-			carrot.Warning("upload dir not exist, create it: ", uploadDir)
-			if err = os.MkdirAll(uploadDir, 0755); err != nil {
-				return "", err
-			}
-		} else {
-			return "", err
-		}
-	}
-	return uploadDir, nil
+// CountMediaReferences return the count of other media which share the stored file
+func CountMediaReferences(db *gorm.DB, media *Media) (int64, error) {
+	var count int64
+	tx := db.Model(&Media{}).Where("store_path", media.StorePath).Where("external", false).Where("directory", false)
+	tx = whereMediaStorage(tx, media.Storage)
+	r := tx.Where("NOT (site_id = ? AND path = ? AND name = ?)", media.SiteID, media.Path, media.Name).Count(&count)
+	return count, r.Error
 }
 
-func StoreLocal(uploadDir, storePath string, data []byte) (string, error) {
-	storePath = filepath.Join(uploadDir, storePath)
-	err := os.WriteFile(storePath, data, 0644)
-	if err != nil {
-		return "", err
+// FindMediaByHash return the media which has the same content in storage
+func FindMediaByHash(db *gorm.DB, storage, hash string) (*Media, error) {
+	var obj Media
+	tx := db.Model(&Media{}).Where("hash", hash).Where("external", false).Where("directory", false).Where("store_path <> ?", "")
+	tx = whereMediaStorage(tx, storage)
+	if err := tx.Order("created_at").Take(&obj).Error; err != nil {
+		return nil, err
 	}
-	return storePath, nil
+	return &obj, nil
 }
 
-func StoreExternal(externalUploader, path, name string, data []byte) (string, error) {
-	buf := new(bytes.Buffer)
-	form := multipart.NewWriter(buf)
-	form.WriteField("path", path)
-	form.WriteField("name", name)
-
-	fileField, _ := form.CreateFormFile("file", name)
-	fileField.Write(data)
-	form.Close()
+// StoreExternal post the file to the external uploader, the multipart body is streamed
+func StoreExternal(externalUploader, path, name string, reader io.Reader) (string, error) {
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := func() error {
+			form.WriteField("path", path)
+			form.WriteField("name", name)
+			fileField, err := form.CreateFormFile("file", name)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(fileField, reader); err != nil {
+				return err
+			}
+			return form.Close()
+		}()
+		pw.CloseWithError(err)
+	}()
+	defer func() {
+		// the reader is never used after return
+		pr.Close()
+		<-done
+	}()
 
-	resp, err := http.Post(externalUploader, form.FormDataContentType(), buf)
+	resp, err := http.Post(externalUploader, form.FormDataContentType(), pr)
 	if err != nil {
 		carrot.Warning("upload to external server failed: ", err, externalUploader)
 		return "", err
 	}
 
 	defer resp.Body.Close()
-	respBody := bytes.NewBuffer(nil)
-	io.Copy(respBody, resp.Body)
-	body := respBody.Bytes()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxExternalResponseSize))
 	if resp.StatusCode != http.StatusOK {
 		carrot.Warning("upload to external server failed: ", resp.StatusCode, externalUploader, string(body))
 		return "", fmt.Errorf("upload to external server failed, code:%d %s", resp.StatusCode, string(body))
@@ -146,6 +186,32 @@ func StoreExternal(externalUploader, path, name string, data []byte) (string, er
 	return remoteResult.StorePath, nil
 }
 
+// Copy the upload to a temp file in dir, the size and sha256 are computed on the fly
+func spoolUpload(dir string, reader io.Reader) (*os.File, int64, string, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, 0, "", err
+		}
+	}
+	f, err := os.CreateTemp(dir, ".upload_*")
+	if err != nil {
+		return nil, 0, "", err
+	}
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, hash), reader)
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, 0, "", err
+	}
+	return f, size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// UploadFile store the file to the external uploader or storage,
+// the file is spooled to disk, so the memory is bounded for any size
 func UploadFile(db *gorm.DB, path, name string, reader io.Reader) (*UploadResult, error) {
 	var r UploadResult
 	r.Path = path
@@ -167,53 +233,110 @@ func UploadFile(db *gorm.DB, path, name string, reader io.Reader) (*UploadResult
 	default:
 		r.ContentType = ContentTypeFile
 	}
-	data, err := io.ReadAll(reader)
+
+	var storage Storage
+	spoolDir := ""
+	externalUploader := carrot.GetValue(db, KEY_CMS_EXTERNAL_UPLOADER)
+	if externalUploader == "" {
+		var err error
+		if storage, err = GetDefaultStorage(db); err != nil {
+			return nil, err
+		}
+		if local, ok := storage.(*LocalStorage); ok {
+			// the same device as the upload dir, the file is renamed instead of copied
+			spoolDir = local.Dir
+		}
+	}
+
+	f, size, hash, err := spoolUpload(spoolDir, reader)
 	if err != nil {
 		return nil, err
 	}
+	defer os.Remove(f.Name())
+	defer f.Close()
 
-	r.Size = int64(len(data))
+	r.Size = size
+	r.Hash = hash
 
-	externalUploader := carrot.GetValue(db, KEY_CMS_EXTERNAL_UPLOADER)
-	if externalUploader != "" {
-		storePath, err := StoreExternal(externalUploader, path, name, data)
+	if storage == nil {
+		storePath, err := StoreExternal(externalUploader, path, name, f)
 		if err != nil {
 			return nil, err
 		}
 		r.StorePath = storePath
 		r.External = true
 	} else {
-		storePath := fmt.Sprintf("%s%s", carrot.RandText(10), r.Ext)
-		r.StorePath = storePath
+		r.Storage = storage.Name()
 		r.External = false
-		uploadDir, err := PrepareStoreLocalDir(db)
-		if err != nil {
-			return nil, err
-		}
-		_, err = StoreLocal(uploadDir, storePath, data)
-		if err != nil {
-			return nil, err
+		if exists, err := FindMediaByHash(db, r.Storage, hash); err == nil {
+			// share the stored file, the file may be removed by hand, so check it
+			if _, err := storage.Stat(exists.StorePath); err == nil {
+				r.StorePath = exists.StorePath
+				r.Dimensions = exists.Dimensions
+				r.Variants = exists.Variants
+				r.Exists = true
+				r.ExistsPath = MediaFullPath(exists.SiteID, exists.Path, exists.Name)
+				return &r, nil
+			}
 		}
+		r.StorePath = fmt.Sprintf("%s%s", carrot.RandText(10), r.Ext)
 	}
 
 	if canGetDimension {
-		config, _, err := image.DecodeConfig(bytes.NewReader(data))
+		var config image.Config
+		if _, err = f.Seek(0, io.SeekStart); err == nil {
+			config, _, err = image.DecodeConfig(f)
+		}
 		if err == nil {
 			r.Dimensions = fmt.Sprintf("%dX%d", config.Width, config.Height)
 		} else {
 			carrot.Warning("decode image config error: ", err)
 			r.Dimensions = "X"
+			canGetDimension = false
+		}
+		if int64(config.Width)*int64(config.Height) > MaxImageVariantPixels {
+			// decoding the huge image takes too much memory
+			canGetDimension = false
+		}
+	}
+
+	if canGetDimension && storage != nil {
+		if sizes := GetImageVariantSizes(db); len(sizes) > 0 {
+			var img image.Image
+			if _, err = f.Seek(0, io.SeekStart); err == nil {
+				img, _, err = image.Decode(f)
+			}
+			if err == nil {
+				r.Variants, err = GenerateImageVariants(storage, r.StorePath, r.Ext, img, sizes)
+				if err != nil {
+					carrot.Warning("generate image variants failed: ", r.StorePath, err)
+				}
+			} else {
+				carrot.Warning("decode image error: ", err)
+			}
+		}
+	}
+
+	if storage != nil {
+		if putter, ok := storage.(StorageFilePutter); ok {
+			err = putter.PutFile(r.StorePath, f.Name())
+		} else if _, err = f.Seek(0, io.SeekStart); err == nil {
+			err = storage.Put(r.StorePath, f, r.Size, "")
+		}
+		if err != nil {
+			RemoveImageVariants(storage, r.StorePath, r.Variants)
+			return nil, err
 		}
 	}
 	return &r, nil
 }
 
-func GetMedia(db *gorm.DB, path, name string) (*Media, error) {
+func GetMedia(db *gorm.DB, siteID, path, name string) (*Media, error) {
 	var obj Media
 	if len(path) > 1 && path[len(path)-1] == '/' {
 		path = path[:len(path)-1]
 	}
-	tx := db.Model(&Media{}).Where("path", path).Where("name", name)
+	tx := db.Model(&Media{}).Where("site_id", siteID).Where("path", path).Where("name", name)
 	r := tx.First(&obj)
 	if r.Error != nil {
 		return nil, r.Error
@@ -0,0 +1,373 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	ContentNamePost     = "post"
+	ContentNamePage     = "page"
+	ContentNameMedia    = "media"
+	ContentNameSite     = "site"
+	ContentNameCategory = "category"
+	ContentNameTag      = "tag"
+)
+
+var ErrInvalidTag = errors.New("invalid tag")
+var ErrTagExists = errors.New("the slug is used by another tag, merge the tags instead")
+
+type Tag struct {
+	ID          uint      `json:"id" gorm:"primarykey"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	CreatedAt   time.Time `json:"createdAt"`
+	SiteID      string    `json:"siteId" gorm:"size:200;uniqueIndex:,composite:_site_slug"`
+	Slug        string    `json:"slug" gorm:"size:100;uniqueIndex:,composite:_site_slug"`
+	Name        string    `json:"name" gorm:"size:100"`
+	Description string    `json:"description,omitempty"`
+	Color       string    `json:"color,omitempty" gorm:"size:32"`
+	Count       int64     `json:"count" gorm:"-"`
+}
+
+// The relation of tag and post/page/media
+// For media, the ContentID is the full path of file
+type ContentTag struct {
+	TagID     uint   `json:"tagId" gorm:"primarykey;autoIncrement:false"`
+	Tag       Tag    `json:"-"`
+	Content   string `json:"content" gorm:"size:12;primarykey;index:,composite:_content_site_id"`
+	SiteID    string `json:"siteId" gorm:"size:200;primarykey;index:,composite:_content_site_id"`
+	ContentID string `json:"contentId" gorm:"size:300;primarykey;index:,composite:_content_site_id"`
+}
+
+func (t Tag) String() string {
+	return t.Name
+}
+
+// SplitTags split the tags string by `,` or `;`, empty and duplicate tags are ignored
+func SplitTags(tags string) []string {
+	vals := strings.FieldsFunc(tags, func(r rune) bool {
+		return r == ',' || r == ';' || r == '，' || r == '；'
+	})
+	exists := map[string]bool{}
+	var r []string
+	for _, val := range vals {
+		val = strings.TrimSpace(val)
+		slug := MakeTagSlug(val)
+		if slug == "" || exists[slug] {
+			continue
+		}
+		exists[slug] = true
+		r = append(r, val)
+	}
+	return r
+}
+
+// MakeTagSlug convert the tag name to lower case slug, eg: `Hello World` => `hello-world`
+func MakeTagSlug(name string) string {
+	var sb strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && sb.Len() > 0 {
+				sb.WriteRune('-')
+			}
+			dash = false
+			sb.WriteRune(r)
+		} else {
+			dash = true
+		}
+	}
+	return sb.String()
+}
+
+func GetOrCreateTag(db *gorm.DB, siteID, name string) (*Tag, error) {
+	slug := MakeTagSlug(name)
+	if slug == "" {
+		return nil, ErrInvalidTag
+	}
+	obj := Tag{
+		SiteID: siteID,
+		Slug:   slug,
+		Name:   strings.TrimSpace(name),
+	}
+	r := db.Where("site_id", siteID).Where("slug", slug).FirstOrCreate(&obj)
+	return &obj, r.Error
+}
+
+// SyncContentTags replace the tags of content with the tags string
+func SyncContentTags(db *gorm.DB, content, siteID, contentID, tags string) error {
+	var tagIDs []uint
+	for _, name := range SplitTags(tags) {
+		tag, err := GetOrCreateTag(db, siteID, name)
+		if err != nil {
+			return err
+		}
+		tagIDs = append(tagIDs, tag.ID)
+	}
+
+	tx := db.Where("content", content).Where("site_id", siteID).Where("content_id", contentID)
+	if len(tagIDs) > 0 {
+		tx = tx.Where("tag_id NOT IN ?", tagIDs)
+	}
+	if err := tx.Delete(&ContentTag{}).Error; err != nil {
+		return err
+	}
+
+	for _, tagID := range tagIDs {
+		obj := ContentTag{
+			TagID:     tagID,
+			Content:   content,
+			SiteID:    siteID,
+			ContentID: contentID,
+		}
+		if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&obj).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func RemoveContentTags(db *gorm.DB, content, siteID, contentID string) error {
+	return db.Where("content", content).Where("site_id", siteID).Where("content_id", contentID).Delete(&ContentTag{}).Error
+}
+
+// GetContentTags return the tags of the content
+func GetContentTags(db *gorm.DB, content, siteID, contentID string) ([]Tag, error) {
+	var vals []Tag = make([]Tag, 0)
+	tx := db.Model(&Tag{}).Joins("JOIN content_tags ON content_tags.tag_id = tags.id")
+	tx = tx.Where("content_tags.content", content).Where("content_tags.site_id", siteID).Where("content_tags.content_id", contentID)
+	r := tx.Order("tags.name").Find(&vals)
+	return vals, r.Error
+}
+
+// Rebuild the tags string of the content from the tag table
+func updateContentTagsString(db *gorm.DB, content, siteID, contentID string) error {
+	tags, err := GetContentTags(db, content, siteID, contentID)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	val := strings.Join(names, ",")
+
+	switch content {
+	case ContentNamePost:
+		return db.Model(&Post{}).Where("site_id", siteID).Where("id", contentID).UpdateColumn("tags", val).Error
+	case ContentNamePage:
+		return db.Model(&Page{}).Where("site_id", siteID).Where("id", contentID).UpdateColumn("tags", val).Error
+	case ContentNameMedia:
+		path, name := splitMediaContentID(contentID)
+		return db.Model(&Media{}).Where("site_id", siteID).Where("path", path).Where("name", name).UpdateColumn("tags", val).Error
+	}
+	return nil
+}
+
+func MediaContentID(path, name string) string {
+	if path == "" || path == "/" {
+		return "/" + name
+	}
+	return strings.TrimSuffix(path, "/") + "/" + name
+}
+
+func splitMediaContentID(contentID string) (string, string) {
+	idx := strings.LastIndex(contentID, "/")
+	if idx <= 0 {
+		return "/", contentID[idx+1:]
+	}
+	return contentID[:idx], contentID[idx+1:]
+}
+
+func updateTagContentsString(db *gorm.DB, tagID uint) error {
+	var vals []ContentTag
+	if err := db.Where("tag_id", tagID).Find(&vals).Error; err != nil {
+		return err
+	}
+	for _, val := range vals {
+		if err := updateContentTagsString(db, val.Content, val.SiteID, val.ContentID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RenameTag rename the tag and update the tags of all related contents,
+// the tag is merged into the exists tag with the same slug
+func RenameTag(db *gorm.DB, tagID uint, name string) (*Tag, error) {
+	return renameTag(db, tagID, name, "", true)
+}
+
+// UpdateTagName change the name and slug of tag and update the tags of all related contents,
+// the slug is generated from name if empty, ErrTagExists when the slug is used by another tag
+func UpdateTagName(db *gorm.DB, tagID uint, name, slug string) (*Tag, error) {
+	return renameTag(db, tagID, name, slug, false)
+}
+
+func renameTag(db *gorm.DB, tagID uint, name, slug string, merge bool) (*Tag, error) {
+	var tag Tag
+	if err := db.First(&tag, tagID).Error; err != nil {
+		return nil, err
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = tag.Name
+	}
+	if slug == "" {
+		slug = name
+	}
+	slug = MakeTagSlug(slug)
+	if slug == "" {
+		return nil, ErrInvalidTag
+	}
+
+	var exists Tag
+	r := db.Where("site_id", tag.SiteID).Where("slug", slug).Where("id <> ?", tag.ID).Take(&exists)
+	if r.Error == nil {
+		if !merge {
+			return nil, ErrTagExists
+		}
+		// rename to an exists tag
+		return &exists, MergeTags(db, tag.ID, exists.ID)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&tag).Updates(map[string]any{"name": name, "slug": slug}).Error; err != nil {
+			return err
+		}
+		return updateTagContentsString(tx, tag.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	tag.Name = name
+	tag.Slug = slug
+	return &tag, nil
+}
+
+// MergeTags move all contents of tag `fromID` to tag `toID`, then remove the tag `fromID`
+func MergeTags(db *gorm.DB, fromID, toID uint) error {
+	if fromID == toID {
+		return nil
+	}
+	var from, to Tag
+	if err := db.First(&from, fromID).Error; err != nil {
+		return err
+	}
+	if err := db.First(&to, toID).Error; err != nil {
+		return err
+	}
+	if from.SiteID != to.SiteID {
+		return errors.New("can not merge tags from different sites")
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var vals []ContentTag
+		if err := tx.Where("tag_id", from.ID).Find(&vals).Error; err != nil {
+			return err
+		}
+		for _, val := range vals {
+			val.TagID = to.ID
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&val).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("tag_id", from.ID).Delete(&ContentTag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&from).Error; err != nil {
+			return err
+		}
+		return updateTagContentsString(tx, to.ID)
+	})
+}
+
+// Remove the tag and update the tags of all related contents
+func RemoveTag(db *gorm.DB, tag *Tag) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var vals []ContentTag
+		if err := tx.Where("tag_id", tag.ID).Find(&vals).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("tag_id", tag.ID).Delete(&ContentTag{}).Error; err != nil {
+			return err
+		}
+		for _, val := range vals {
+			if err := updateContentTagsString(tx, val.Content, val.SiteID, val.ContentID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func CountTagContents(db *gorm.DB, tagID uint) int64 {
+	var count int64
+	db.Model(&ContentTag{}).Where("tag_id", tagID).Count(&count)
+	return count
+}
+
+// QueryTags return all tag names used by the content
+func QueryTags(db *gorm.DB, content string) ([]string, error) {
+	var vals []string = make([]string, 0)
+	tx := db.Model(&Tag{}).Distinct("tags.name").Joins("JOIN content_tags ON content_tags.tag_id = tags.id")
+	r := tx.Where("content_tags.content", content).Order("tags.name").Pluck("tags.name", &vals)
+	return vals, r.Error
+}
+
+// MigrateTagsColumn drop the index of tags string, the column is text now and the tags are queried by content_tags
+func MigrateTagsColumn(db *gorm.DB) error {
+	for _, obj := range []any{&Page{}, &Post{}, &Media{}} {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(obj); err != nil {
+			return err
+		}
+		name := db.NamingStrategy.IndexName(stmt.Schema.Table, "tags")
+		if !db.Migrator().HasIndex(obj, name) {
+			continue
+		}
+		if err := db.Migrator().DropIndex(obj, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrateLegacyTags build the tag table from the tags string of posts, pages and media
+func MigrateLegacyTags(db *gorm.DB) error {
+	var posts []Post
+	if err := db.Select("site_id", "id", "tags").Where("tags <> ''").Find(&posts).Error; err != nil {
+		return err
+	}
+	for _, post := range posts {
+		if err := SyncContentTags(db, ContentNamePost, post.SiteID, post.ID, post.Tags); err != nil {
+			return err
+		}
+	}
+
+	var pages []Page
+	if err := db.Select("site_id", "id", "tags").Where("tags <> ''").Find(&pages).Error; err != nil {
+		return err
+	}
+	for _, page := range pages {
+		if err := SyncContentTags(db, ContentNamePage, page.SiteID, page.ID, page.Tags); err != nil {
+			return err
+		}
+	}
+
+	var files []Media
+	if err := db.Select("site_id", "path", "name", "tags").Where("directory", false).Where("tags <> ''").Find(&files).Error; err != nil {
+		return err
+	}
+	for _, media := range files {
+		if err := SyncContentTags(db, ContentNameMedia, media.SiteID, MediaContentID(media.Path, media.Name), media.Tags); err != nil {
+			return err
+		}
+	}
+	return nil
+}
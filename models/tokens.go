@@ -0,0 +1,144 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/restsend/carrot"
+	"gorm.io/gorm"
+)
+
+const ApiTokenPrefix = "rct_"
+
+// The token is only returned once when it's created or regenerated, only the hash is stored
+type ApiToken struct {
+	ID         uint         `json:"id" gorm:"primarykey"`
+	CreatedAt  time.Time    `json:"createdAt"`
+	UpdatedAt  time.Time    `json:"updatedAt"`
+	Name       string       `json:"name" gorm:"size:128"`
+	UserID     uint         `json:"-"`
+	User       carrot.User  `json:"user"`
+	Prefix     string       `json:"prefix" gorm:"size:12"`
+	TokenHash  string       `json:"-" gorm:"size:64;uniqueIndex"`
+	Token      string       `json:"token,omitempty" gorm:"-"`
+	Scopes     string       `json:"scopes" gorm:"size:200"`                 // split by comma, eg: read:post,write:*
+	SiteID     string       `json:"siteId,omitempty" gorm:"size:100;index"` // empty is all sites
+	Enabled    bool         `json:"enabled"`
+	ExpiredAt  sql.NullTime `json:"expiredAt"`
+	LastUsedAt sql.NullTime `json:"lastUsedAt"`
+}
+
+func HashApiToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+func IsApiToken(token string) bool {
+	return strings.HasPrefix(token, ApiTokenPrefix)
+}
+
+// Fill a new random token, the old token is invalid after save
+func (t *ApiToken) GenerateToken() string {
+	t.Token = ApiTokenPrefix + carrot.RandText(ApiTokenSize)
+	t.TokenHash = HashApiToken(t.Token)
+	t.Prefix = t.Token[:len(ApiTokenPrefix)+4]
+	return t.Token
+}
+
+func (t *ApiToken) GetScopes() []string {
+	var vals []string
+	for _, v := range strings.Split(t.Scopes, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			vals = append(vals, v)
+		}
+	}
+	return vals
+}
+
+// CheckApiScopes check the scopes split by comma, only the scopes of ApiScopes are allowed
+func CheckApiScopes(scopes string) error {
+	token := ApiToken{Scopes: scopes}
+	for _, v := range token.GetScopes() {
+		found := false
+		for _, opt := range ApiScopes {
+			if opt.Value == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%w: %s", ErrInvalidApiScope, v)
+		}
+	}
+	return nil
+}
+
+// HasScope check the scope, `read:*` and `write:*` match all contents
+func (t *ApiToken) HasScope(scope string) bool {
+	action, _, _ := strings.Cut(scope, ":")
+	for _, v := range t.GetScopes() {
+		if v == scope || v == action+":*" {
+			return true
+		}
+		// write implies read
+		if action == "read" && (v == "write:*" || v == "write"+strings.TrimPrefix(scope, "read")) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *ApiToken) IsExpired(now time.Time) bool {
+	return t.ExpiredAt.Valid && !t.ExpiredAt.Time.After(now)
+}
+
+// Get the enabled and not expired token, the last used time is updated
+func GetApiToken(db *gorm.DB, token string) (*ApiToken, error) {
+	if !IsApiToken(token) {
+		return nil, ErrUnauthorized
+	}
+	var obj ApiToken
+	r := db.Preload("User").Where("token_hash", HashApiToken(token)).First(&obj)
+	if r.Error != nil {
+		return nil, r.Error
+	}
+	now := time.Now()
+	if !obj.Enabled {
+		return nil, ErrApiTokenDisabled
+	}
+	if obj.IsExpired(now) {
+		return nil, ErrApiTokenExpired
+	}
+	obj.LastUsedAt = sql.NullTime{Time: now, Valid: true}
+	db.Model(&ApiToken{}).Where("id", obj.ID).UpdateColumn("last_used_at", now)
+	return &obj, nil
+}
+
+// Regenerate the token, return the new token
+func RegenerateApiToken(db *gorm.DB, id uint) (*ApiToken, error) {
+	var obj ApiToken
+	if err := db.Where("id", id).First(&obj).Error; err != nil {
+		return nil, err
+	}
+	obj.GenerateToken()
+	r := db.Model(&ApiToken{}).Where("id", id).Updates(map[string]any{
+		"token_hash": obj.TokenHash,
+		"prefix":     obj.Prefix,
+	})
+	return &obj, r.Error
+}
+
+func RevokeApiToken(db *gorm.DB, id uint) error {
+	r := db.Model(&ApiToken{}).Where("id", id).UpdateColumn("enabled", false)
+	if r.Error != nil {
+		return r.Error
+	}
+	if r.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
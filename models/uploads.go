@@ -0,0 +1,203 @@
+package models
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/restsend/carrot"
+	"gorm.io/gorm"
+)
+
+const UploadSessionIDSize = 24
+const DefaultUploadSessionExpires = 24 // hours
+
+// UploadSession is a resumable upload, the chunks are appended to a part file by offset,
+// the same as tus protocol: create, patch with offset, query offset and finish
+type UploadSession struct {
+	ID        string      `json:"id" gorm:"primaryKey;size:64"`
+	CreatedAt time.Time   `json:"createdAt"`
+	UpdatedAt time.Time   `json:"updatedAt"`
+	CreatorID uint        `json:"-"`
+	Creator   carrot.User `json:"-"`
+	SiteID    string      `json:"siteId" gorm:"size:200"`
+	Path      string      `json:"path" gorm:"size:200"`
+	Name      string      `json:"name" gorm:"size:200"`
+	Size      int64       `json:"size"`                               // total size
+	Offset    int64       `json:"offset" gorm:"column:upload_offset"` // bytes received
+	ExpiredAt time.Time   `json:"expiredAt" gorm:"index"`
+}
+
+// The chunks of the same session are written one by one
+var uploadSessionLocks sync.Map
+
+// LockUploadSession lock the session against the other chunks and finish, return the unlock func
+func LockUploadSession(id string) func() {
+	val, _ := uploadSessionLocks.LoadOrStore(id, &sync.Mutex{})
+	mu := val.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
+func getUploadChunkDir(db *gorm.DB) (string, error) {
+	dir := carrot.GetValue(db, KEY_CMS_UPLOAD_CHUNK_DIR)
+	if dir == "" {
+		return "", ErrUploadsDirNotConfigured
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+func (s *UploadSession) partFile(db *gorm.DB) (string, error) {
+	dir, err := getUploadChunkDir(db)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, s.ID+".part"), nil
+}
+
+func CreateUploadSession(db *gorm.DB, siteID, path, name string, size int64, user *carrot.User) (*UploadSession, error) {
+	if name == "" {
+		return nil, ErrInvalidPathAndName
+	}
+	if size <= 0 {
+		return nil, ErrInvalidUploadSize
+	}
+	if path == "" {
+		path = "/"
+	}
+	expires := carrot.GetIntValue(db, KEY_CMS_UPLOAD_SESSION_EXPIRES, DefaultUploadSessionExpires)
+	s := &UploadSession{
+		ID:        carrot.RandText(UploadSessionIDSize),
+		SiteID:    siteID,
+		Path:      path,
+		Name:      name,
+		Size:      size,
+		ExpiredAt: time.Now().Add(time.Duration(expires) * time.Hour),
+	}
+	if user != nil {
+		s.CreatorID = user.ID
+	}
+	partFile, err := s.partFile(db)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Create(partFile)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+
+	if err := db.Omit("Creator").Create(s).Error; err != nil {
+		os.Remove(partFile)
+		return nil, err
+	}
+	return s, nil
+}
+
+// GetUploadSession return the session of user, the expired session is not found
+func GetUploadSession(db *gorm.DB, id string, user *carrot.User) (*UploadSession, error) {
+	var s UploadSession
+	tx := db.Where("id", id).Where("expired_at > ?", time.Now())
+	if user != nil {
+		tx = tx.Where("creator_id", user.ID)
+	}
+	if err := tx.Take(&s).Error; err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// WriteUploadChunk append the chunk at offset, the bytes received before the connection
+// is broken are kept, so the client can query the offset and resume
+func WriteUploadChunk(db *gorm.DB, s *UploadSession, offset int64, reader io.Reader) error {
+	unlock := LockUploadSession(s.ID)
+	defer unlock()
+
+	// reload the offset, the other chunk may be written
+	if err := db.Model(s).Select("upload_offset").Where("id", s.ID).Take(&s.Offset).Error; err != nil {
+		return err
+	}
+	if offset != s.Offset {
+		return ErrUploadOffsetMismatch
+	}
+
+	partFile, err := s.partFile(db)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(partFile, os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// drop the bytes which are not recorded
+	if err := f.Truncate(offset); err != nil {
+		return err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	remain := s.Size - offset
+	n, copyErr := io.Copy(f, io.LimitReader(reader, remain+1))
+	if n > remain {
+		f.Truncate(offset)
+		return ErrUploadChunkTooLarge
+	}
+	if n > 0 {
+		s.Offset = offset + n
+		if err := db.Model(s).Where("id", s.ID).UpdateColumns(map[string]any{
+			"upload_offset": s.Offset,
+			"updated_at":    time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return copyErr
+}
+
+// OpenUploadSession open the assembled file when all chunks are received,
+// the session must be locked, the offset is reloaded and the removed session is not found
+func OpenUploadSession(db *gorm.DB, s *UploadSession) (*os.File, error) {
+	if err := db.Model(s).Select("upload_offset").Where("id", s.ID).Take(&s.Offset).Error; err != nil {
+		return nil, err
+	}
+	if s.Offset != s.Size {
+		return nil, ErrUploadIncomplete
+	}
+	partFile, err := s.partFile(db)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(partFile)
+}
+
+func RemoveUploadSession(db *gorm.DB, s *UploadSession) error {
+	if partFile, err := s.partFile(db); err == nil {
+		if err := os.Remove(partFile); err != nil && !os.IsNotExist(err) {
+			carrot.Warning("remove upload part failed: ", partFile, err)
+		}
+	}
+	uploadSessionLocks.Delete(s.ID)
+	return db.Where("id", s.ID).Delete(&UploadSession{}).Error
+}
+
+// CleanExpiredUploadSessions remove the sessions which are not finished in time
+func CleanExpiredUploadSessions(db *gorm.DB, now time.Time) (int, error) {
+	var sessions []UploadSession
+	if err := db.Where("expired_at <= ?", now).Find(&sessions).Error; err != nil {
+		return 0, err
+	}
+	for i := range sessions {
+		if err := RemoveUploadSession(db, &sessions[i]); err != nil {
+			return i, err
+		}
+	}
+	return len(sessions), nil
+}
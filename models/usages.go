@@ -0,0 +1,270 @@
+package models
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/restsend/carrot"
+	"gorm.io/gorm"
+)
+
+const (
+	MediaFieldBody      = "body"
+	MediaFieldDraft     = "draft"
+	MediaFieldThumbnail = "thumbnail"
+)
+
+const mediaReferenceBatchSize = 100
+
+// MediaReference is the media url found in the body, draft or thumbnail of page/post,
+// the index is updated when the content is saved
+type MediaReference struct {
+	ID        uint   `json:"-" gorm:"primarykey"`
+	Content   string `json:"content" gorm:"size:12;index:,composite:_content_site_id"`
+	SiteID    string `json:"siteId" gorm:"size:200;index:,composite:_content_site_id"`
+	ContentID string `json:"contentId" gorm:"size:200;index:,composite:_content_site_id"`
+	// the media, MediaSiteID is empty for the shared library
+	MediaSiteID string `json:"mediaSiteId" gorm:"size:200;not null;default:'';index:,composite:_media"`
+	Path        string `json:"path" gorm:"size:200;index:,composite:_media"`
+	Name        string `json:"name" gorm:"size:200;index:,composite:_media"`
+	Field       string `json:"field" gorm:"size:20"`
+}
+
+// MediaUsage is the page/post which uses the media
+type MediaUsage struct {
+	Content   string   `json:"content"`
+	SiteID    string   `json:"siteId"`
+	ContentID string   `json:"contentId"`
+	Title     string   `json:"title"`
+	Published bool     `json:"published"`
+	Fields    []string `json:"fields"`
+}
+
+type OrphanMediaResult struct {
+	Total int     `json:"total"`
+	Size  int64   `json:"size"`
+	Items []Media `json:"items"`
+}
+
+// ParseMediaReferences find the media urls in text, return the site, path and name of media,
+// eg: `<img src="https://cdn.example.com/media/@example.com/logo/a.png?variant=small">` => ["example.com", "/logo", "a.png"]
+func ParseMediaReferences(text, mediaPrefix string) [][3]string {
+	if len(mediaPrefix) <= 1 {
+		return nil
+	}
+	var r [][3]string
+	exists := map[[3]string]bool{}
+	for {
+		pos := strings.Index(text, mediaPrefix)
+		if pos < 0 {
+			break
+		}
+		text = text[pos+len(mediaPrefix):]
+		end := strings.IndexAny(text, "\"'`()<>[]?#\\ \t\r\n")
+		if end < 0 {
+			end = len(text)
+		}
+		fullPath, err := url.PathUnescape(text[:end])
+		text = text[end:]
+		if err != nil || fullPath == "" {
+			continue
+		}
+		siteID, path, name := ParseMediaFullPath(fullPath)
+		if name == "" {
+			continue
+		}
+		key := [3]string{siteID, path, name}
+		if !exists[key] {
+			exists[key] = true
+			r = append(r, key)
+		}
+	}
+	return r
+}
+
+func getMediaReferenceFields(obj any) (string, string, string, map[string]string) {
+	if page, ok := obj.(*Page); ok {
+		return ContentNamePage, page.SiteID, page.ID, map[string]string{
+			MediaFieldBody:      page.Body,
+			MediaFieldDraft:     page.Draft,
+			MediaFieldThumbnail: page.Thumbnail,
+		}
+	} else if post, ok := obj.(*Post); ok {
+		return ContentNamePost, post.SiteID, post.ID, map[string]string{
+			MediaFieldBody:      post.Body,
+			MediaFieldDraft:     post.Draft,
+			MediaFieldThumbnail: post.Thumbnail,
+		}
+	}
+	return "", "", "", nil
+}
+
+// UpdateMediaReferences replace the media references of page/post
+func UpdateMediaReferences(db *gorm.DB, obj any) error {
+	content, siteID, contentID, fields := getMediaReferenceFields(obj)
+	if content == "" {
+		return ErrInvalidContentType
+	}
+	if err := RemoveMediaReferences(db, content, siteID, contentID); err != nil {
+		return err
+	}
+	mediaPrefix := carrot.GetValue(db, KEY_CMS_MEDIA_PREFIX)
+	var refs []MediaReference
+	for _, field := range []string{MediaFieldBody, MediaFieldDraft, MediaFieldThumbnail} {
+		for _, key := range ParseMediaReferences(fields[field], mediaPrefix) {
+			refs = append(refs, MediaReference{
+				Content:     content,
+				SiteID:      siteID,
+				ContentID:   contentID,
+				MediaSiteID: key[0],
+				Path:        key[1],
+				Name:        key[2],
+				Field:       field,
+			})
+		}
+	}
+	if len(refs) == 0 {
+		return nil
+	}
+	return db.CreateInBatches(refs, 100).Error
+}
+
+func RemoveMediaReferences(db *gorm.DB, content, siteID, contentID string) error {
+	return db.Where("content", content).Where("site_id", siteID).Where("content_id", contentID).Delete(&MediaReference{}).Error
+}
+
+// RebuildMediaReferences scan all pages and posts, the references are built from scratch in a transaction,
+// so the others never see the empty references
+func RebuildMediaReferences(db *gorm.DB) (count int, err error) {
+	err = db.Transaction(func(tx *gorm.DB) error {
+		count, err = rebuildMediaReferences(tx)
+		return err
+	})
+	return count, err
+}
+
+func rebuildMediaReferences(db *gorm.DB) (int, error) {
+	if err := db.Where("1 = 1").Delete(&MediaReference{}).Error; err != nil {
+		return 0, err
+	}
+	count := 0
+	for pos := 0; ; pos += mediaReferenceBatchSize {
+		var pages []Page
+		if err := findMediaReferenceBatch(db, pos).Find(&pages).Error; err != nil {
+			return count, err
+		}
+		for i := range pages {
+			if err := UpdateMediaReferences(db, &pages[i]); err != nil {
+				return count, err
+			}
+		}
+		count += len(pages)
+		if len(pages) < mediaReferenceBatchSize {
+			break
+		}
+	}
+	for pos := 0; ; pos += mediaReferenceBatchSize {
+		var posts []Post
+		if err := findMediaReferenceBatch(db, pos).Find(&posts).Error; err != nil {
+			return count, err
+		}
+		for i := range posts {
+			if err := UpdateMediaReferences(db, &posts[i]); err != nil {
+				return count, err
+			}
+		}
+		count += len(posts)
+		if len(posts) < mediaReferenceBatchSize {
+			break
+		}
+	}
+	return count, nil
+}
+
+func findMediaReferenceBatch(db *gorm.DB, pos int) *gorm.DB {
+	return db.Select("site_id", "id", "body", "draft", "thumbnail").Order("site_id, id").Offset(pos).Limit(mediaReferenceBatchSize)
+}
+
+// GetMediaUsages return the pages and posts which use the media
+func GetMediaUsages(db *gorm.DB, siteID, path, name string) ([]MediaUsage, error) {
+	var refs []MediaReference
+	if err := db.Where("media_site_id", siteID).Where("path", path).Where("name", name).Order("id").Find(&refs).Error; err != nil {
+		return nil, err
+	}
+	var r []MediaUsage
+	index := map[[3]string]int{}
+	for _, ref := range refs {
+		key := [3]string{ref.Content, ref.SiteID, ref.ContentID}
+		if pos, ok := index[key]; ok {
+			r[pos].Fields = append(r[pos].Fields, ref.Field)
+			continue
+		}
+		usage := MediaUsage{
+			Content:   ref.Content,
+			SiteID:    ref.SiteID,
+			ContentID: ref.ContentID,
+			Fields:    []string{ref.Field},
+		}
+		var obj any = &Page{}
+		if ref.Content == ContentNamePost {
+			obj = &Post{}
+		}
+		var row struct {
+			Title     string
+			Published bool
+		}
+		if err := db.Model(obj).Select("title", "published").Where("site_id", ref.SiteID).Where("id", ref.ContentID).Take(&row).Error; err == nil {
+			usage.Title = row.Title
+			usage.Published = row.Published
+		}
+		index[key] = len(r)
+		r = append(r, usage)
+	}
+	return r, nil
+}
+
+// CountMediaUsages return the count of references to the media
+func CountMediaUsages(db *gorm.DB, siteID, path, name string) (int64, error) {
+	var count int64
+	r := db.Model(&MediaReference{}).Where("media_site_id", siteID).Where("path", path).Where("name", name).Count(&count)
+	return count, r.Error
+}
+
+// CountDirectoryUsages return the count of references to the media in directory and its sub directories
+func CountDirectoryUsages(db *gorm.DB, siteID, path string) (int64, error) {
+	var count int64
+	path = strings.TrimSuffix(path, "/")
+	tx := db.Model(&MediaReference{}).Where("media_site_id", siteID)
+	if path == "" {
+		return count, tx.Count(&count).Error
+	}
+	r := tx.Where("path = ? OR path LIKE ?", path, path+"/%").Count(&count)
+	return count, r.Error
+}
+
+// ListOrphanMedia return the files which are not used by any page or post
+func ListOrphanMedia(db *gorm.DB) (*OrphanMediaResult, error) {
+	var refs []MediaReference
+	if err := db.Model(&MediaReference{}).Distinct("media_site_id", "path", "name").Find(&refs).Error; err != nil {
+		return nil, err
+	}
+	used := make(map[[3]string]bool, len(refs))
+	for _, ref := range refs {
+		used[[3]string{ref.MediaSiteID, ref.Path, ref.Name}] = true
+	}
+
+	var files []Media
+	if err := db.Where("directory", false).Order("path, name").Find(&files).Error; err != nil {
+		return nil, err
+	}
+	r := OrphanMediaResult{Items: []Media{}}
+	for _, media := range files {
+		if used[[3]string{media.SiteID, media.Path, media.Name}] {
+			continue
+		}
+		r.Items = append(r.Items, media)
+		r.Size += media.Size
+	}
+	r.Total = len(r.Items)
+	return &r, nil
+}
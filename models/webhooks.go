@@ -0,0 +1,349 @@
+package models
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/restsend/carrot"
+	"gorm.io/gorm"
+)
+
+const (
+	EventCreate    = "create"
+	EventUpdate    = "update"
+	EventPublish   = "publish"
+	EventUnpublish = "unpublish"
+	EventDelete    = "delete"
+	EventUpload    = "upload"
+	EventPing      = "ping"
+)
+
+const (
+	DeliveryPending = "pending"
+	DeliveryRunning = "running"
+	DeliverySuccess = "success"
+	DeliveryFailed  = "failed"
+)
+
+const DefaultWebhookMaxAttempts = 5
+const DefaultWebhookTimeout = 10
+const webhookBackoff = 30 * time.Second
+const webhookMaxBackoff = time.Hour
+const webhookResponseSize = 1024
+
+var WebhookEvents = []carrot.AdminSelectOption{
+	{Value: "post.create", Label: "Post created"},
+	{Value: "post.update", Label: "Post updated"},
+	{Value: "post.publish", Label: "Post published"},
+	{Value: "post.unpublish", Label: "Post unpublished"},
+	{Value: "post.delete", Label: "Post deleted"},
+	{Value: "page.create", Label: "Page created"},
+	{Value: "page.update", Label: "Page updated"},
+	{Value: "page.publish", Label: "Page published"},
+	{Value: "page.unpublish", Label: "Page unpublished"},
+	{Value: "page.delete", Label: "Page deleted"},
+	{Value: "media.upload", Label: "Media uploaded"},
+	{Value: "media.delete", Label: "Media deleted"},
+}
+
+type Webhook struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Name      string    `json:"name" gorm:"size:128"`
+	Url       string    `json:"url" gorm:"size:500"`
+	Secret    string    `json:"secret,omitempty" gorm:"size:128"`       // write only, hidden when rendered, use Rotate Secret to read a new one
+	Events    string    `json:"events" gorm:"size:500"`                 // split by comma, eg: post.publish,page.*, empty is all events
+	SiteID    string    `json:"siteId,omitempty" gorm:"size:200;index"` // empty is all sites
+	Enabled   bool      `json:"enabled"`
+}
+
+type WebhookDelivery struct {
+	ID          uint         `json:"id" gorm:"primarykey"`
+	CreatedAt   time.Time    `json:"createdAt"`
+	UpdatedAt   time.Time    `json:"updatedAt"`
+	WebhookID   uint         `json:"-" gorm:"index"`
+	Webhook     Webhook      `json:"webhook"`
+	Event       string       `json:"event" gorm:"size:64"`
+	SiteID      string       `json:"siteId,omitempty" gorm:"size:200"`
+	Payload     string       `json:"payload"`
+	Status      string       `json:"status" gorm:"size:20;index:idx_delivery_status"`
+	Attempts    int          `json:"attempts"`
+	NextRetryAt sql.NullTime `json:"nextRetryAt" gorm:"index:idx_delivery_status"`
+	StatusCode  int          `json:"statusCode"`
+	Response    string       `json:"response,omitempty"`
+	Error       string       `json:"error,omitempty"`
+}
+
+type WebhookPayload struct {
+	Event     string `json:"event"`
+	SiteID    string `json:"siteId,omitempty"`
+	Timestamp int64  `json:"timestamp"`
+	Data      any    `json:"data,omitempty"`
+}
+
+// Notify the delivery worker there are new deliveries
+var webhookNotify = make(chan struct{}, 1)
+
+func WebhookNotify() <-chan struct{} {
+	return webhookNotify
+}
+
+func GetEventName(content, action string) string {
+	return content + "." + action
+}
+
+// Match the event with filter, `post.*` match all events of post
+func (w *Webhook) MatchEvent(event string) bool {
+	if strings.TrimSpace(w.Events) == "" {
+		return true
+	}
+	content, _, _ := strings.Cut(event, ".")
+	for _, v := range strings.Split(w.Events, ",") {
+		v = strings.TrimSpace(v)
+		if v == event || v == "*" || v == content+".*" {
+			return true
+		}
+	}
+	return false
+}
+
+func CheckWebhookUrl(val string) error {
+	u, err := url.Parse(val)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidWebhookUrl
+	}
+	return nil
+}
+
+// SignWebhookPayload sign the `timestamp.payload` with HMAC-SHA256
+func SignWebhookPayload(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func newDelivery(webhook *Webhook, event, siteID string, data any) (*WebhookDelivery, error) {
+	payload, err := json.Marshal(WebhookPayload{
+		Event:     event,
+		SiteID:    siteID,
+		Timestamp: time.Now().Unix(),
+		Data:      data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &WebhookDelivery{
+		WebhookID:   webhook.ID,
+		Event:       event,
+		SiteID:      siteID,
+		Payload:     string(payload),
+		Status:      DeliveryPending,
+		NextRetryAt: sql.NullTime{Time: time.Now(), Valid: true},
+	}, nil
+}
+
+// FireWebhook queue the deliveries of the enabled webhooks matched event and site
+func FireWebhook(db *gorm.DB, event, siteID string, data any) {
+	var webhooks []Webhook
+	tx := db.Where("enabled", true)
+	if siteID != "" {
+		tx = tx.Where("site_id = '' OR site_id IS NULL OR site_id = ?", siteID)
+	}
+	if err := tx.Find(&webhooks).Error; err != nil {
+		carrot.Warning("query webhooks failed:", event, err)
+		return
+	}
+
+	count := 0
+	for idx := range webhooks {
+		webhook := &webhooks[idx]
+		if !webhook.MatchEvent(event) {
+			continue
+		}
+		delivery, err := newDelivery(webhook, event, siteID, data)
+		if err == nil {
+			err = db.Omit("Webhook").Create(delivery).Error
+		}
+		if err != nil {
+			carrot.Warning("create webhook delivery failed:", webhook.ID, event, err)
+			continue
+		}
+		count++
+	}
+	if count > 0 {
+		select {
+		case webhookNotify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Send a ping event to the webhook
+func PingWebhook(db *gorm.DB, id uint) (*WebhookDelivery, error) {
+	var webhook Webhook
+	if err := db.Where("id", id).First(&webhook).Error; err != nil {
+		return nil, err
+	}
+	delivery, err := newDelivery(&webhook, EventPing, webhook.SiteID, map[string]any{"name": webhook.Name})
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Omit("Webhook").Create(delivery).Error; err != nil {
+		return nil, err
+	}
+	if err := DeliverWebhook(db, delivery.ID); err != nil {
+		return nil, err
+	}
+	err = db.Where("id", delivery.ID).First(delivery).Error
+	return delivery, err
+}
+
+// Replace the secret of webhook with a random one
+func RotateWebhookSecret(db *gorm.DB, id uint) (string, error) {
+	secret := carrot.RandText(SiteApiKeySize)
+	r := db.Model(&Webhook{}).Where("id", id).UpdateColumn("secret", secret)
+	if r.Error != nil {
+		return "", r.Error
+	}
+	if r.RowsAffected == 0 {
+		return "", gorm.ErrRecordNotFound
+	}
+	return secret, nil
+}
+
+// Redeliver the delivery, the attempts is reset
+func RedeliverWebhook(db *gorm.DB, id uint) error {
+	r := db.Model(&WebhookDelivery{}).Where("id", id).Updates(map[string]any{
+		"status":        DeliveryPending,
+		"attempts":      0,
+		"next_retry_at": time.Now(),
+	})
+	if r.Error != nil {
+		return r.Error
+	}
+	select {
+	case webhookNotify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// The backoff of attempts: 30s, 1m, 2m, 4m ... up to 1h
+func getWebhookBackoff(attempts int) time.Duration {
+	backoff := webhookBackoff
+	for i := 1; i < attempts && backoff < webhookMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > webhookMaxBackoff {
+		backoff = webhookMaxBackoff
+	}
+	return backoff
+}
+
+// DeliverWebhook send the delivery, the failed delivery is retried with backoff until max attempts
+func DeliverWebhook(db *gorm.DB, id uint) error {
+	// claim the delivery, avoid sending twice by multiple workers
+	r := db.Model(&WebhookDelivery{}).Where("id", id).Where("status", DeliveryPending).Update("status", DeliveryRunning)
+	if r.Error != nil {
+		return r.Error
+	}
+	if r.RowsAffected == 0 {
+		return nil
+	}
+
+	var delivery WebhookDelivery
+	if err := db.Preload("Webhook").Where("id", id).First(&delivery).Error; err != nil {
+		return err
+	}
+
+	vals := map[string]any{"attempts": delivery.Attempts + 1}
+	statusCode, response, err := sendWebhook(db, &delivery)
+	vals["status_code"] = statusCode
+	vals["response"] = response
+	if err == nil {
+		vals["status"] = DeliverySuccess
+		vals["error"] = ""
+	} else {
+		vals["error"] = err.Error()
+		maxAttempts := carrot.GetIntValue(db, KEY_CMS_WEBHOOK_MAX_ATTEMPTS, DefaultWebhookMaxAttempts)
+		if delivery.Attempts+1 >= maxAttempts || !delivery.Webhook.Enabled {
+			vals["status"] = DeliveryFailed
+		} else {
+			vals["status"] = DeliveryPending
+			vals["next_retry_at"] = time.Now().Add(getWebhookBackoff(delivery.Attempts + 1))
+		}
+	}
+	return db.Model(&WebhookDelivery{}).Where("id", id).Updates(vals).Error
+}
+
+func sendWebhook(db *gorm.DB, delivery *WebhookDelivery) (int, string, error) {
+	webhook := &delivery.Webhook
+	if webhook.ID == 0 {
+		return 0, "", gorm.ErrRecordNotFound
+	}
+	if !webhook.Enabled {
+		return 0, "", fmt.Errorf("webhook %d is disabled", webhook.ID)
+	}
+
+	payload := []byte(delivery.Payload)
+	timestamp := time.Now().Unix()
+	req, err := http.NewRequest(http.MethodPost, webhook.Url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "RestContent-Webhook")
+	req.Header.Set("X-RestContent-Event", delivery.Event)
+	req.Header.Set("X-RestContent-Delivery", fmt.Sprintf("%d", delivery.ID))
+	req.Header.Set("X-RestContent-Timestamp", fmt.Sprintf("%d", timestamp))
+	if webhook.Secret != "" {
+		req.Header.Set("X-RestContent-Signature", SignWebhookPayload(webhook.Secret, timestamp, payload))
+	}
+
+	timeout := carrot.GetIntValue(db, KEY_CMS_WEBHOOK_TIMEOUT, DefaultWebhookTimeout)
+	client := &http.Client{Timeout: time.Duration(timeout) * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseSize))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, string(data), fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return resp.StatusCode, string(data), nil
+}
+
+// RunWebhookDeliveries send the due deliveries, return the count of sent
+func RunWebhookDeliveries(db *gorm.DB, now time.Time) (int, error) {
+	// the worker is crashed when sending
+	stale := db.Model(&WebhookDelivery{}).Where("status", DeliveryRunning).Where("updated_at < ?", now.Add(-webhookMaxBackoff))
+	if err := stale.UpdateColumn("status", DeliveryPending).Error; err != nil {
+		return 0, err
+	}
+
+	var ids []uint
+	tx := db.Model(&WebhookDelivery{}).Where("status", DeliveryPending).Where("next_retry_at <= ?", now)
+	if err := tx.Order("id").Limit(MaxQueryLimit).Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		if err := DeliverWebhook(db, id); err != nil {
+			carrot.Warning("deliver webhook failed:", id, err)
+		}
+	}
+	return len(ids), nil
+}
@@ -0,0 +1,253 @@
+package models
+
+import (
+	"sort"
+	"time"
+
+	"github.com/restsend/carrot"
+	"gorm.io/gorm"
+)
+
+// The workflow state of the draft, Published is still the flag of the live body
+const (
+	StateDraft     = "draft"
+	StateInReview  = "in_review"
+	StateApproved  = "approved"
+	StatePublished = "published"
+	StateArchived  = "archived"
+)
+
+const (
+	WorkflowSubmit    = "submit"
+	WorkflowApprove   = "approve"
+	WorkflowReject    = "reject"
+	WorkflowPublish   = "publish"
+	WorkflowUnpublish = "unpublish"
+	WorkflowArchive   = "archive"
+	WorkflowRestore   = "restore"
+)
+
+// action => from state => to state
+var workflowTransitions = map[string]map[string]string{
+	WorkflowSubmit: {
+		StateDraft: StateInReview,
+	},
+	WorkflowApprove: {
+		StateInReview: StateApproved,
+	},
+	WorkflowReject: {
+		StateInReview: StateDraft,
+		StateApproved: StateDraft,
+	},
+	WorkflowArchive: {
+		StateDraft:     StateArchived,
+		StateInReview:  StateArchived,
+		StateApproved:  StateArchived,
+		StatePublished: StateArchived,
+	},
+	WorkflowRestore: {
+		StateArchived: StateDraft,
+	},
+}
+
+var WorkflowStates = []carrot.AdminSelectOption{
+	{Value: StateDraft, Label: "Draft"},
+	{Value: StateInReview, Label: "In Review"},
+	{Value: StateApproved, Label: "Approved"},
+	{Value: StatePublished, Label: "Published"},
+	{Value: StateArchived, Label: "Archived"},
+}
+
+type ReviewLog struct {
+	ID        uint        `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time   `json:"createdAt"`
+	UserID    uint        `json:"-"`
+	User      carrot.User `json:"user"`
+	Content   string      `json:"content" gorm:"size:12;index:idx_review_content"` // post or page
+	SiteID    string      `json:"siteId" gorm:"size:200;index:idx_review_content"`
+	ContentID string      `json:"contentId" gorm:"size:100;index:idx_review_content"`
+	Action    string      `json:"action" gorm:"size:20"`
+	FromState string      `json:"fromState" gorm:"size:20"`
+	ToState   string      `json:"toState" gorm:"size:20"`
+	Comment   string      `json:"comment,omitempty"`
+}
+
+type ReviewItem struct {
+	Content    string    `json:"content"`
+	SiteID     string    `json:"siteId"`
+	ID         string    `json:"id"`
+	Title      string    `json:"title"`
+	Author     string    `json:"author"`
+	CategoryID string    `json:"categoryId,omitempty"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// GetState return the workflow state, the legacy content without state is draft or published
+func (c *BaseContent) GetState() string {
+	if c.State != "" {
+		return c.State
+	}
+	if c.Published {
+		return StatePublished
+	}
+	return StateDraft
+}
+
+func getWorkflowContent(obj any) (base *BaseContent, siteID, ID, categoryID string) {
+	switch v := obj.(type) {
+	case *Page:
+		return &v.BaseContent, v.SiteID, v.ID, v.CategoryID
+	case *Post:
+		return &v.BaseContent, v.SiteID, v.ID, v.CategoryID
+	}
+	return nil, "", "", ""
+}
+
+// Check the category of content requires review before publish
+func IsReviewRequired(db *gorm.DB, siteID, categoryID string) bool {
+	if categoryID == "" {
+		return false
+	}
+	var count int64
+	db.Model(&Category{}).Where("site_id", siteID).Where("uuid", categoryID).Where("review_required", true).Count(&count)
+	return count > 0
+}
+
+// CheckCanPublish check the content can be published in current state
+func CheckCanPublish(db *gorm.DB, obj any) error {
+	base, siteID, _, categoryID := getWorkflowContent(obj)
+	if base == nil {
+		return ErrInvalidContentType
+	}
+	switch base.GetState() {
+	case StateArchived:
+		return ErrInvalidWorkflowAction
+	case StateApproved:
+		return nil
+	}
+	if IsReviewRequired(db, siteID, categoryID) {
+		// the published state means there is no change after the last publish
+		if base.GetState() == StatePublished && base.Published {
+			return nil
+		}
+		return ErrReviewRequired
+	}
+	return nil
+}
+
+func CreateReviewLog(db *gorm.DB, obj any, action, fromState, toState, comment string, user *carrot.User) error {
+	_, siteID, ID, _ := getWorkflowContent(obj)
+	log := ReviewLog{
+		Content:   GetContentName(obj),
+		SiteID:    siteID,
+		ContentID: ID,
+		Action:    action,
+		FromState: fromState,
+		ToState:   toState,
+		Comment:   comment,
+	}
+	if user != nil {
+		log.UserID = user.ID
+	}
+	return db.Omit("User").Create(&log).Error
+}
+
+// MakeTransition change the workflow state of loaded content, publish and unpublish must use MakePublish.
+// The updated_at is untouched, so the scheduled publish is still pending after approve.
+func MakeTransition(db *gorm.DB, obj any, action, comment string, user *carrot.User) (string, error) {
+	base, siteID, ID, _ := getWorkflowContent(obj)
+	if base == nil {
+		return "", ErrInvalidContentType
+	}
+	fromState := base.GetState()
+	toState, ok := workflowTransitions[action][fromState]
+	if !ok {
+		return "", ErrInvalidWorkflowAction
+	}
+
+	wasPublished := base.Published
+	vals := map[string]any{"state": toState}
+	if action == WorkflowArchive {
+		vals["published"] = false
+	}
+	r := db.Model(obj).Where("site_id", siteID).Where("id", ID).UpdateColumns(vals)
+	if r.Error != nil {
+		return "", r.Error
+	}
+	base.State = toState
+	if action == WorkflowArchive {
+		base.Published = false
+	}
+	if err := CreateReviewLog(db, obj, action, fromState, toState, comment, user); err != nil {
+		return "", err
+	}
+	if action == WorkflowArchive && wasPublished {
+		// the same as MakePublish(false), the sync of search index misses it without updated_at
+		if err := RemoveSearchIndex(db, GetContentName(obj), siteID, ID); err != nil {
+			carrot.Warning("remove search index failed:", siteID, ID, err)
+		}
+		FireWebhook(db, GetEventName(GetContentName(obj), EventUnpublish), siteID, obj)
+	}
+	return toState, nil
+}
+
+// The draft is changed, the review must start over
+func resetWorkflowState(db *gorm.DB, obj any, siteID, ID string) error {
+	tx := db.Model(obj).Where("site_id", siteID).Where("id", ID)
+	tx = tx.Where("state IS NULL OR state <> ?", StateArchived)
+	return tx.UpdateColumn("state", StateDraft).Error
+}
+
+// ListReviewQueue return the contents waiting for review, the oldest first. Empty content is pages and posts
+func ListReviewQueue(db *gorm.DB, content, siteID string, user *carrot.User, limit int) ([]ReviewItem, error) {
+	if limit <= 0 || limit > MaxQueryLimit {
+		limit = DefaultQueryLimit
+	}
+	items := make([]ReviewItem, 0)
+	contents := []struct {
+		name string
+		obj  any
+	}{
+		{ContentNamePage, &Page{}},
+		{ContentNamePost, &Post{}},
+	}
+	for _, item := range contents {
+		if content != "" && content != item.name {
+			continue
+		}
+		// only the sites which the user can review
+		sites, all, err := PermittedSites(db, user, item.name, PermPublish)
+		if err != nil {
+			return nil, err
+		}
+		if !all && len(sites) == 0 {
+			continue
+		}
+		var vals []ReviewItem
+		tx := db.Model(item.obj).Where("state", StateInReview)
+		if !all {
+			tx = tx.Where("site_id IN ?", sites)
+		}
+		if siteID != "" {
+			tx = tx.Where("site_id", siteID)
+		}
+		if err := tx.Order("updated_at").Limit(limit).Find(&vals).Error; err != nil {
+			return nil, err
+		}
+		for i := range vals {
+			vals[i].Content = item.name
+		}
+		items = append(items, vals...)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].UpdatedAt.Before(items[j].UpdatedAt) })
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	return items, nil
+}
+
+func ListReviewLogs(db *gorm.DB, content, siteID, ID string) ([]ReviewLog, error) {
+	var vals []ReviewLog
+	r := db.Preload("User").Where("content", content).Where("site_id", siteID).Where("content_id", ID).Order("id desc").Find(&vals)
+	return vals, r.Error
+}
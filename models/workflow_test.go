@@ -0,0 +1,51 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestArchiveRemovesSearchIndex(t *testing.T) {
+	db := newTestDB(t)
+	now := time.Now()
+	post := Post{SiteID: "example.com", ID: "hello", Body: "the archived gopher"}
+	post.Title = "Hello"
+	post.ContentType = ContentTypeText
+	post.Published = true
+	post.State = StatePublished
+	post.PublishedAt.Time, post.PublishedAt.Valid = now.Add(-time.Hour), true
+	if err := db.Create(&post).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := IndexContent(db, &post); err != nil {
+		t.Fatal(err)
+	}
+
+	search := func() int {
+		r, err := SearchContents(db, &SearchForm{SiteID: post.SiteID, Query: "gopher"}, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r.Total
+	}
+	if total := search(); total != 1 {
+		t.Fatalf("total = %d before archive, want 1", total)
+	}
+
+	state, err := MakeTransition(db, &post, WorkflowArchive, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != StateArchived || post.Published {
+		t.Errorf("state = %s, published = %v after archive", state, post.Published)
+	}
+	if total := search(); total != 0 {
+		t.Errorf("total = %d after archive, want 0", total)
+	}
+	if _, err := SyncSearchIndex(db); err != nil {
+		t.Fatal(err)
+	}
+	if total := search(); total != 0 {
+		t.Errorf("total = %d after sync, want 0", total)
+	}
+}
@@ -0,0 +1,81 @@
+package restcontent
+
+import (
+	"time"
+
+	"github.com/restsend/carrot"
+	"github.com/restsend/restcontent/models"
+)
+
+const webhookRetryInterval = 10 * time.Second
+
+// Start the background scheduler for PublishedAt and UnpublishAt
+func (m *Manager) StartScheduler() {
+	interval := carrot.GetIntValue(m.db, models.KEY_CMS_SCHEDULE_INTERVAL, 60)
+	if interval <= 0 {
+		carrot.Warning("Scheduler is disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+		for {
+			m.runSchedule()
+			<-ticker.C
+		}
+	}()
+}
+
+func (m *Manager) runSchedule() {
+	defer func() {
+		if err := recover(); err != nil {
+			carrot.Warning("Scheduler crash:", err)
+		}
+	}()
+
+	r, err := models.RunSchedule(m.db, time.Now())
+	if err != nil {
+		carrot.Warning("Run schedule failed:", err)
+		return
+	}
+	if r.Published > 0 || r.Unpublished > 0 {
+		carrot.Warning("Schedule done, published:", r.Published, "unpublished:", r.Unpublished)
+	}
+
+	// the contents changed since last sync are indexed here
+	if _, err := models.SyncSearchIndex(m.db); err != nil {
+		carrot.Warning("Sync search index failed:", err)
+	}
+
+	if _, err := models.CleanExpiredUploadSessions(m.db, time.Now()); err != nil {
+		carrot.Warning("Clean upload sessions failed:", err)
+	}
+}
+
+// Start the background worker to deliver webhooks, the failed deliveries are retried by interval
+func (m *Manager) StartWebhookWorker() {
+	go func() {
+		ticker := time.NewTicker(webhookRetryInterval)
+		defer ticker.Stop()
+		for {
+			m.runWebhookDeliveries()
+			select {
+			case <-ticker.C:
+			case <-models.WebhookNotify():
+			}
+		}
+	}()
+}
+
+func (m *Manager) runWebhookDeliveries() {
+	defer func() {
+		if err := recover(); err != nil {
+			carrot.Warning("Webhook worker crash:", err)
+		}
+	}()
+
+	if _, err := models.RunWebhookDeliveries(m.db, time.Now()); err != nil {
+		carrot.Warning("Run webhook deliveries failed:", err)
+	}
+}
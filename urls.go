@@ -2,21 +2,23 @@ package restcontent
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/restsend/carrot"
 	"github.com/restsend/restcontent/models"
+	"gorm.io/gorm"
 )
 
 func (m *Manager) RegisterHandlers(engine *gin.Engine) {
-	admin := engine.Group("/admin", carrot.WithAdminAuth())
+	admin := engine.Group("/admin", carrot.WithAdminAuth(), m.runAfterWrite)
 	handledObjects := carrot.BuildAdminObjects(admin, m.db, m.adminObjects())
 
 	mediaPrefix := carrot.GetValue(m.db, models.KEY_CMS_MEDIA_PREFIX)
 	if mediaPrefix == "" {
 		mediaPrefix = "/media/"
 	}
-	media := engine.Group(mediaPrefix, m.AuthRequired)
+	media := engine.Group(mediaPrefix, m.MediaAuthRequired, m.apiScopeRequired(models.ContentNameMedia))
 	media.GET("/*filepath", m.handleMedia)
 
 	admin.POST("/admin.json", func(ctx *gin.Context) {
@@ -48,51 +50,153 @@ func (m *Manager) RegisterHandlers(engine *gin.Engine) {
 	if prefix == "" {
 		prefix = "/api"
 	}
-	routes := engine.Group(prefix, m.AuthRequired)
+	routes := engine.Group(prefix, m.AuthRequired, m.runAfterWrite)
+	// site and category are readable by all api tokens
 	objs := []carrot.WebObject{
 		{
 			Model:        &models.Site{},
 			AllowMethods: carrot.GET | carrot.QUERY,
 			Name:         "site",
-			Editables:    []string{"Domain", "Name", "Preview", "Disallow"},
+			Editables:    []string{"Domain", "Name", "Preview", "Disallow", "PageUrlPattern", "PostUrlPattern"},
 			Filterables:  []string{},
 			Orderables:   []string{},
 			Searchables:  []string{"Domain", "Name"},
+			GetDB:        m.getSiteDB,
 		},
 		{
 			Model:        &models.Category{},
-			AllowMethods: carrot.GET | carrot.QUERY,
+			AllowMethods: carrot.GET | carrot.QUERY | carrot.CREATE | carrot.EDIT | carrot.DELETE,
 			Name:         "category",
 			Editables:    []string{"UUID", "SiteID", "Name", "Items"},
 			Filterables:  []string{},
 			Orderables:   []string{},
 			Searchables:  []string{"UUID", "Name", "Items"},
+			GetDB:        m.getCategoryDB,
+			BeforeCreate: m.beforeCreateCategory,
+			BeforeUpdate: m.beforeUpdateCategory,
+			BeforeDelete: m.beforeDeleteCategory,
 		},
+	}
+	for _, obj := range objs {
+		carrot.RegisterObjects(routes.Group("", m.apiWriteRequired(obj.Name)), []carrot.WebObject{obj})
+	}
+
+	contentObjs := []carrot.WebObject{
 		{
 			Model:        &models.Page{},
-			AllowMethods: carrot.GET | carrot.QUERY,
+			AllowMethods: carrot.GET | carrot.QUERY | carrot.CREATE | carrot.EDIT | carrot.DELETE,
 			Name:         "page",
+			Editables:    []string{"ID", "SiteID", "CategoryID", "CategoryPath", "Author", "Draft", "Published", "PublishedAt", "ScheduledAt", "UnpublishAt", "Thumbnail", "Tags", "Title", "Alt", "Description", "Keywords", "Remark"},
 			Filterables:  []string{"SiteID", "CategoryID", "CategoryPath", "Tags", "IsDraft", "Published", "ContentType"},
 			Searchables:  []string{"Title", "Description", "Body"},
 			Orderables:   []string{"CreatedAt", "UpdatedAt", "PublishedAt"},
 			GetDB:        m.getPostOrPageDB,
+			BeforeCreate: m.beforeCreatePage,
+			BeforeUpdate: m.beforeUpdatePage,
+			BeforeDelete: m.beforeDeletePage,
 			BeforeRender: m.beforeRenderPage,
 		},
 		{
 			Model:             &models.Post{},
-			AllowMethods:      carrot.GET | carrot.QUERY,
+			AllowMethods:      carrot.GET | carrot.QUERY | carrot.CREATE | carrot.EDIT | carrot.DELETE,
 			Name:              "post",
+			Editables:         []string{"ID", "SiteID", "CategoryID", "CategoryPath", "Author", "Draft", "Published", "PublishedAt", "ScheduledAt", "UnpublishAt", "ContentType", "Thumbnail", "Tags", "Title", "Alt", "Description", "Keywords", "Remark"},
 			Filterables:       []string{"SiteID", "CategoryID", "CategoryPath", "Tags", "IsDraft", "Published", "ContentType"},
 			Searchables:       []string{"Title", "Description", "Body"},
 			Orderables:        []string{"CreatedAt", "UpdatedAt", "PublishedAt"},
 			GetDB:             m.getPostOrPageDB,
+			BeforeCreate:      m.beforeCreatePost,
+			BeforeUpdate:      m.beforeUpdatePost,
+			BeforeDelete:      m.beforeDeletePost,
 			BeforeRender:      m.beforeRenderPost,
 			BeforeQueryRender: m.beforeQueryRenderPost,
 		},
+		{
+			Model:        &models.Media{},
+			AllowMethods: carrot.GET | carrot.QUERY | carrot.EDIT | carrot.DELETE,
+			Name:         "media",
+			Editables:    []string{"Author", "Published", "PublishedAt", "Tags", "Title", "Alt", "Description", "Keywords", "Remark"},
+			Filterables:  []string{"SiteID", "Path", "ContentType", "Directory", "Published", "Tags"},
+			Searchables:  []string{"Title", "Alt", "Description", "Keywords", "Name"},
+			Orderables:   []string{"CreatedAt", "UpdatedAt", "Size"},
+			GetDB:        m.getMediaDB,
+			BeforeCreate: m.beforeCreateMedia,
+			BeforeUpdate: m.beforeUpdateMedia,
+			BeforeDelete: m.beforeDeleteMedia,
+			BeforeRender: m.beforeRenderMedia,
+		},
+	}
+	for _, obj := range contentObjs {
+		carrot.RegisterObjects(routes.Group("", m.apiScopeRequired(obj.Name)), []carrot.WebObject{obj})
+	}
+
+	// the same semantics as admin actions
+	for _, content := range []string{models.ContentNamePage, models.ContentNamePost} {
+		m.registerApiActions(routes.Group("", m.apiScopeRequired(content)), content, map[string]apiActionFunc{
+			"save_draft": m.handleSaveDraft,
+			"duplicate":  m.handleMakePageDuplicate,
+			"submit_review": func(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+				return m.handleWorkflow(db, c, obj, models.WorkflowSubmit)
+			},
+			"make_publish": func(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+				return m.handleMakePagePublish(db, c, obj, true)
+			},
+			"make_un_publish": func(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+				return m.handleMakePagePublish(db, c, obj, false)
+			},
+		})
 	}
-	carrot.RegisterObjects(routes, objs)
+	m.registerApiActions(routes.Group("", m.apiScopeRequired(models.ContentNameMedia)), models.ContentNameMedia, map[string]apiActionFunc{
+		"upload":        m.handleApiUpload,
+		"upload_create": m.handleUploadCreate,
+		"upload_chunk":  m.handleUploadChunk,
+		"upload_status": m.handleUploadStatus,
+		"upload_finish": func(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+			return m.handleUploadFinish(db, c, true)
+		},
+		"new_folder": m.handleNewFolder,
+		"signed_url": m.handleSignedMediaURL,
+		"make_publish": func(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+			return m.handleMakeMediaPublish(db, c, obj, true)
+		},
+		"make_un_publish": func(db *gorm.DB, c *gin.Context, obj any) (any, error) {
+			return m.handleMakeMediaPublish(db, c, obj, false)
+		},
+	})
 
 	routes.POST("/tags/:content_type", m.handleGetTags)
+	routes.POST("/tags/:content_type/query", m.handleQueryByTags)
+	routes.GET("/sitemap/:name", m.handleSitemap)
+	routes.GET("/feed/:site/:format", m.handleFeed)
+	routes.GET("/search", m.handleSearch)
+}
+
+// The site scope of request authorized by site api key
+const SiteScopeField = "_restcontent_site_scope"
+const afterWriteField = "_restcontent_after_write"
+
+// afterWrite run fn when the request succeeds, the Before* hooks use it for the work which needs the written row
+func afterWrite(c *gin.Context, fn func(db *gorm.DB)) {
+	var pending []func(db *gorm.DB)
+	if val, ok := c.Get(afterWriteField); ok {
+		pending = val.([]func(db *gorm.DB))
+	}
+	c.Set(afterWriteField, append(pending, fn))
+}
+
+// The middleware runs the queued functions when the write is done, the failed request runs nothing
+func (m *Manager) runAfterWrite(c *gin.Context) {
+	c.Next()
+	val, ok := c.Get(afterWriteField)
+	if !ok {
+		return
+	}
+	if c.IsAborted() || c.Writer.Status() >= http.StatusBadRequest {
+		return
+	}
+	for _, fn := range val.([]func(db *gorm.DB)) {
+		fn(m.db)
+	}
 }
 
 func (m *Manager) AuthRequired(c *gin.Context) {
@@ -101,27 +205,127 @@ func (m *Manager) AuthRequired(c *gin.Context) {
 		return
 	}
 
-	guestAccess := carrot.GetBoolValue(m.db, models.KEY_CMS_GUEST_ACCESS_API)
-	if guestAccess {
+	guestAccess := false
+	if carrot.GetBoolValue(m.db, models.KEY_CMS_GUEST_ACCESS_API) {
 		switch c.Request.Method {
 		case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodOptions:
-			c.Next()
-			return
+			guestAccess = true
 		}
 	}
 
-	token := c.GetHeader("Authorization")
+	// split bearer
+	token := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
 	if token == "" {
+		if guestAccess {
+			c.Next()
+			return
+		}
 		carrot.AbortWithJSONError(c, http.StatusUnauthorized, models.ErrUnauthorized)
 		return
 	}
-	// split bearer
-	token = token[len("Bearer "):]
+
+	if models.IsApiToken(token) {
+		apiToken, err := models.GetApiToken(m.db, token)
+		if err != nil {
+			// the invalid or expired token is rejected, even if guest access is enabled
+			carrot.AbortWithJSONError(c, http.StatusUnauthorized, err)
+			return
+		}
+		c.Set(ApiTokenField, apiToken)
+		if apiToken.SiteID != "" {
+			c.Set(SiteScopeField, apiToken.SiteID)
+		}
+		c.Next()
+		return
+	}
+
+	if site, err := models.GetSiteByApiKey(m.db, token); err == nil {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodOptions:
+			c.Set(SiteScopeField, site.Domain)
+			c.Next()
+		default:
+			carrot.AbortWithJSONError(c, http.StatusForbidden, models.ErrUnauthorized)
+		}
+		return
+	}
+
 	user, err := carrot.DecodeHashToken(m.db, token, false)
 	if err != nil {
+		if guestAccess {
+			c.Next()
+			return
+		}
 		carrot.AbortWithJSONError(c, http.StatusUnauthorized, err)
 		return
 	}
 	c.Set(carrot.UserField, user)
 	c.Next()
 }
+
+// The signed media url is shared without auth, the signature is checked by handleMedia
+func (m *Manager) MediaAuthRequired(c *gin.Context) {
+	if c.Query(models.MediaQuerySignature) != "" {
+		c.Next()
+		return
+	}
+	m.AuthRequired(c)
+}
+
+// The site the request is limited to, empty means no limit
+func getSiteScope(c *gin.Context) string {
+	if val, ok := c.Get(SiteScopeField); ok {
+		return val.(string)
+	}
+	return ""
+}
+
+// Guest is the request without user, api token and site api key
+func isGuest(c *gin.Context) bool {
+	return carrot.CurrentUser(c) == nil && getApiToken(c) == nil && getSiteScope(c) == ""
+}
+
+// Limit the query to the sites the request can read, siteField is the column of site domain
+func (m *Manager) withSiteAccess(c *gin.Context, db *gorm.DB, siteField string) *gorm.DB {
+	if scope := getSiteScope(c); scope != "" {
+		return db.Where(siteField, scope)
+	}
+	if isGuest(c) {
+		return db.Where(siteField+" NOT IN (?)", models.DisallowSites(m.db))
+	}
+	return db
+}
+
+// The scope of withSiteAccess, the query is filtered without sharing the statement of db
+func (m *Manager) siteAccessScope(c *gin.Context, siteField string) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		return m.withSiteAccess(c, tx, siteField)
+	}
+}
+
+// Check the request can read the contents of site
+func (m *Manager) canAccessSite(c *gin.Context, site *models.Site) bool {
+	if scope := getSiteScope(c); scope != "" {
+		return scope == site.Domain
+	}
+	if isGuest(c) {
+		return !site.Disallow
+	}
+	return true
+}
+
+// Check the request can write the contents of site
+func checkSiteScope(c *gin.Context, siteId string) error {
+	if scope := getSiteScope(c); scope != "" && scope != siteId {
+		return models.ErrSiteScopeDenied
+	}
+	return nil
+}
+
+func (m *Manager) getSiteDB(ctx *gin.Context, isCreate bool) *gorm.DB {
+	return m.withSiteAccess(ctx, m.db, "domain")
+}
+
+func (m *Manager) getCategoryDB(ctx *gin.Context, isCreate bool) *gorm.DB {
+	return m.withSiteAccess(ctx, m.db, "site_id")
+}